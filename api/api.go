@@ -0,0 +1,10 @@
+// Package api holds the OpenAPI documents of the JSON API, embedded so the server doesn't read them from its working
+// directory.
+package api
+
+import _ "embed"
+
+// OpenAPIv1 is the OpenAPI document of the /api/v1 endpoints
+//
+//go:embed v1/openapi.json
+var OpenAPIv1 []byte
@@ -0,0 +1,165 @@
+// Package chart draws the horizontal bar charts of the vaccine pages as SVG and PNG images, for readers without
+// JavaScript and for social sharing previews.
+package chart
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Width and Height are the size of the images, the 1.91:1 ratio social previews are cropped to
+const (
+	Width  = 1200
+	Height = 630
+)
+
+const (
+	margin      = 20
+	titleHeight = 50
+	labelWidth  = 330
+	valueWidth  = 110
+	// maxLabelChars fits a label in labelWidth at the PNG font size
+	maxLabelChars = 26
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	// barColor is the color of the D3 chart's bars
+	barColor  = color.RGBA{0x69, 0xb3, 0xa2, 0xff}
+	textColor = color.RGBA{0x3d, 0x41, 0x44, 0xff}
+)
+
+// Bar is a labeled value, ValueLabel is the value as shown next to the bar
+type Bar struct {
+	Label      string
+	Value      float64
+	ValueLabel string
+}
+
+// BarChart lists the bars from the top in the order given, scaled to the largest value
+type BarChart struct {
+	Title string
+	Bars  []Bar
+	// Empty is shown instead of the bars when there are none
+	Empty string
+}
+
+// bar is a Bar placed on the image
+type bar struct {
+	Bar
+	label string
+	rect  image.Rectangle
+}
+
+// layout places the bars, as many as fit the image, with the longest bar ending before the value labels
+func (c BarChart) layout() []bar {
+	bars := c.Bars
+	top := margin + titleHeight
+	if len(bars) == 0 {
+		return nil
+	}
+	rowHeight := (Height - top - margin) / len(bars)
+	if rowHeight < minRowHeight {
+		rowHeight = minRowHeight
+		bars = bars[:(Height-top-margin)/rowHeight]
+	}
+	if rowHeight > maxRowHeight {
+		rowHeight = maxRowHeight
+	}
+
+	var max float64
+	for _, b := range bars {
+		if b.Value > max {
+			max = b.Value
+		}
+	}
+
+	left := margin + labelWidth
+	span := Width - left - margin - valueWidth
+	var placed []bar
+	for i, b := range bars {
+		w := 0
+		if max > 0 {
+			w = int(b.Value / max * float64(span))
+		}
+		y := top + i*rowHeight
+		placed = append(placed, bar{
+			Bar:   b,
+			label: truncate(b.Label, maxLabelChars),
+			rect:  image.Rect(left, y+2, left+w, y+rowHeight-2),
+		})
+	}
+	return placed
+}
+
+const (
+	// minRowHeight fits a line of the PNG font with a gap between the bars
+	minRowHeight = fontScale*glyphHeight + 4
+	maxRowHeight = 60
+)
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// SVG writes the chart as an SVG image
+func (c BarChart) SVG(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s">`+"\n", Width, Height, Width, Height, html.EscapeString(c.Title))
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hex(background))
+	fmt.Fprintf(&b, `<g font-family="sans-serif" fill="%s">`+"\n", hex(textColor))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="26" font-weight="bold">%s</text>`+"\n", margin, margin+28, html.EscapeString(c.Title))
+
+	bars := c.layout()
+	if len(bars) == 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="18">%s</text>`+"\n", margin, margin+titleHeight+24, html.EscapeString(c.Empty))
+	}
+	for _, br := range bars {
+		r := br.rect
+		middle := (r.Min.Y + r.Max.Y) / 2
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="15" text-anchor="end" dominant-baseline="middle"><title>%s</title>%s</text>`+"\n",
+			r.Min.X-10, middle, html.EscapeString(br.Label), html.EscapeString(br.label))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), hex(barColor))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="15" dominant-baseline="middle">%s</text>`+"\n", r.Max.X+8, middle, html.EscapeString(br.ValueLabel))
+	}
+	b.WriteString("</g>\n</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// PNG writes the chart as a PNG image, with the labels in a bitmap font
+func (c BarChart) PNG(w io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+
+	drawText(img, margin, margin+8, truncate(c.Title, (Width-2*margin)/(titleScale*glyphAdvance)), titleScale, textColor)
+
+	bars := c.layout()
+	if len(bars) == 0 {
+		drawText(img, margin, margin+titleHeight+8, c.Empty, fontScale, textColor)
+	}
+	for _, br := range bars {
+		r := br.rect
+		y := (r.Min.Y+r.Max.Y)/2 - fontScale*glyphHeight/2
+		drawText(img, r.Min.X-10-textWidth(br.label, fontScale), y, br.label, fontScale, textColor)
+		draw.Draw(img, r, &image.Uniform{C: barColor}, image.Point{}, draw.Src)
+		drawText(img, r.Max.X+8, y, br.ValueLabel, fontScale, textColor)
+	}
+
+	return png.Encode(w, img)
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
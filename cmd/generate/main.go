@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/thehungrysmurf/vax/config"
+	"github.com/thehungrysmurf/vax/db/store"
+	"github.com/thehungrysmurf/vax/server"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/joeshaw/envdecode"
+)
+
+// page is a URL of the site and the file it's generated into
+type page struct {
+	Path string
+	File string
+	// Status is the answer expected from the router, anything else fails the page
+	Status int
+}
+
+// newPage is generated into the index.html of the path's directory, or the named file for paths like /robots.txt,
+// the chart images and the downloads. A static host looks the file up by the unescaped path, e.g. a lot page's
+// /lot/EL%201%2F2/ in lot/EL 1/2/, unless unescaping it would climb out of the directory.
+func newPage(urlPath string) page {
+	file := strings.TrimPrefix(urlPath, "/")
+	if unescaped, err := url.PathUnescape(file); err == nil && path.Clean("/"+unescaped) == "/"+strings.TrimSuffix(unescaped, "/") {
+		file = unescaped
+	}
+	if file == "" || strings.HasSuffix(file, "/") {
+		file += "index.html"
+	}
+	return page{Path: urlPath, File: filepath.FromSlash(file), Status: http.StatusOK}
+}
+
+// generate renders every page of the site through the router the api command serves, without going over HTTP, and
+// writes the ones whose content changed into SITE_DIR. It exits non-zero when any page fails to render.
+func main() {
+	var cfg config.Config
+	err := envdecode.Decode(&cfg)
+	if err != nil {
+		log.Fatalf("failed to read config: %v", err)
+	}
+	workers := cfg.GenerateWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx := context.Background()
+	// a connection isn't safe to share between goroutines, so every worker renders with a router of its own
+	routers := make([]http.Handler, workers)
+	var dbClient *store.DB
+	for i := range routers {
+		conn, err := pgx.Connect(ctx, cfg.DatabaseURI)
+		if err != nil {
+			log.Fatalf("failed to connect to database: %v", err)
+		}
+		defer conn.Close(ctx)
+
+		dbClient = store.NewDB(conn)
+		routers[i] = server.NewStaticRouter(dbClient)
+	}
+
+	paths, err := server.SitePaths(ctx, dbClient, true)
+	if err != nil {
+		log.Fatalf("failed to list pages: %v", err)
+	}
+	images, err := server.ImagePaths(ctx, dbClient)
+	if err != nil {
+		log.Fatalf("failed to list images: %v", err)
+	}
+	downloads, err := server.DownloadPaths(ctx, dbClient)
+	if err != nil {
+		log.Fatalf("failed to list downloads: %v", err)
+	}
+	pages := []page{
+		newPage("/sitemap.xml"),
+		newPage("/robots.txt"),
+		{Path: "/404", File: "404.html", Status: http.StatusNotFound},
+	}
+	for _, p := range append(append(paths, images...), downloads...) {
+		pages = append(pages, newPage(p))
+	}
+
+	var (
+		mu       sync.Mutex
+		failures []string
+		written  int
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan page)
+	for _, router := range routers {
+		wg.Add(1)
+		go func(router http.Handler) {
+			defer wg.Done()
+			for p := range jobs {
+				changed, err := generatePage(router, cfg.SiteDir, p)
+				mu.Lock()
+				if err != nil {
+					failures = append(failures, err.Error())
+				} else if changed {
+					written++
+					log.Printf("--> Wrote %s", p.File)
+				}
+				mu.Unlock()
+			}
+		}(router)
+	}
+	for _, p := range pages {
+		jobs <- p
+	}
+	close(jobs)
+	wg.Wait()
+
+	assets, err := copyAssets("assets", filepath.Join(cfg.SiteDir, "assets"))
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("failed to copy assets: %v", err))
+	}
+
+	if len(failures) > 0 {
+		for _, f := range failures {
+			log.Print(f)
+		}
+		log.Fatalf("failed to generate %d of %d pages", len(failures), len(pages))
+	}
+	log.Printf("--> Generated %d pages, wrote %d changed pages and %d changed assets", len(pages), written, assets)
+}
+
+// generatePage renders the page through the router and writes it into dir, reporting whether the file changed
+func generatePage(router http.Handler, dir string, p page) (bool, error) {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p.Path, nil))
+	if rec.Code != p.Status {
+		// the error is logged with the request ID by the server
+		return false, fmt.Errorf("failed to render %s: status %d, request %s", p.Path, rec.Code, rec.Header().Get("X-Request-ID"))
+	}
+
+	changed, err := writeIfChanged(filepath.Join(dir, p.File), rec.Body.Bytes())
+	if err != nil {
+		return false, fmt.Errorf("failed to write %s: %v", p.File, err)
+	}
+	return changed, nil
+}
+
+// copyAssets copies the static assets into dir, returning how many files changed
+func copyAssets(src, dir string) (int, error) {
+	changed := 0
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		ok, err := writeIfChanged(filepath.Join(dir, rel), b)
+		if ok {
+			changed++
+		}
+		return err
+	})
+	return changed, err
+}
+
+// writeIfChanged writes the file unless it already has the content, so unchanged pages keep their modification times
+// and don't show up in the diff of the generated site
+func writeIfChanged(path string, b []byte) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err == nil && bytes.Equal(existing, b) {
+		return false, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	return true, ioutil.WriteFile(path, b, 0644)
+}
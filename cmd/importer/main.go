@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/thehungrysmurf/vax/config"
 	"github.com/thehungrysmurf/vax/db/store"
@@ -27,7 +28,31 @@ func main() {
 
 	dbClient := store.NewDB(conn)
 
-	dataImporter := importer.NewCSVImporter(cfg.VaccinationTotalsFilePath, cfg.ReportsFilePath, cfg.VaccinesFilePath, cfg.SymptomsFilePath, dbClient)
+	var dataImporter importer.CSVImporter
+	if len(cfg.VaersArchives) > 0 {
+		dataImporter, err = importer.NewArchiveImporter(cfg.VaccinationTotalsFilePath, cfg.VaersArchives, dbClient)
+		if err != nil {
+			log.Fatalf("failed to read VAERS archives: %v", err)
+		}
+	} else {
+		if cfg.ReportsFilePath == "" || cfg.VaccinesFilePath == "" || cfg.SymptomsFilePath == "" {
+			log.Fatal("either VAERS_ARCHIVES or REPORTS_FILE_PATH, VACCINES_FILE_PATH and SYMPTOMS_FILE_PATH must be set")
+		}
+		dataImporter = importer.NewCSVImporter(cfg.VaccinationTotalsFilePath, cfg.ReportsFilePath, cfg.VaccinesFilePath, cfg.SymptomsFilePath, dbClient)
+	}
+	if cfg.AgeSexDosesFilePath != "" {
+		dataImporter.AgeSexDosesFile = importer.FileSource(cfg.AgeSexDosesFilePath, false)
+	}
+	dataImporter.Incremental = cfg.Incremental
+	dataImporter.ChangelogFilePath = cfg.ChangelogFilePath
+
+	if cfg.VaersReleaseDate != "" {
+		releaseDate, err := time.Parse("2006-01-02", cfg.VaersReleaseDate)
+		if err != nil {
+			log.Fatalf("failed to parse VAERS release date %q: %v", cfg.VaersReleaseDate, err)
+		}
+		dataImporter.VaersReleaseDate = &releaseDate
+	}
 	if err := dataImporter.Run(); err != nil {
 		log.Fatalf("failed to importer data: %v", err)
 	}
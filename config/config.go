@@ -1,9 +1,20 @@
 package config
 
 type Config struct {
-	SymptomsFilePath string `env:"SYMPTOMS_FILE_PATH,required"`
-	VaccinesFilePath string `env:"VACCINES_FILE_PATH,required"`
-	ReportsFilePath string `env:"REPORTS_FILE_PATH,required"`
+	// VAERS zip archives or directories holding them, separated by ';', used instead of the extracted file paths
+	VaersArchives []string `env:"VAERS_ARCHIVES"`
+	SymptomsFilePath string `env:"SYMPTOMS_FILE_PATH"`
+	VaccinesFilePath string `env:"VACCINES_FILE_PATH"`
+	ReportsFilePath string `env:"REPORTS_FILE_PATH"`
 	VaccinationTotalsFilePath string `env:"VACCINATION_TOTALS_FILE_PATH,required"`
+	// AgeSexDosesFilePath is the doses by sex and age group, without it there are no age and sex rates
+	AgeSexDosesFilePath string `env:"AGE_SEX_DOSES_FILE_PATH"`
 	DatabaseURI string `env:"DB_URI,required"`
+	Incremental bool `env:"INCREMENTAL,default=false"`
+	ChangelogFilePath string `env:"CHANGELOG_FILE_PATH"`
+	VaersReleaseDate string `env:"VAERS_RELEASE_DATE"`
+	// SiteDir is where the generate command writes the static site
+	SiteDir string `env:"SITE_DIR,default=docs"`
+	// GenerateWorkers is the number of pages rendered at once, each worker has its own database connection
+	GenerateWorkers int `env:"GENERATE_WORKERS,default=4"`
 }
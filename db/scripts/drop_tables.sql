@@ -1,5 +1,8 @@
 DROP TABLE people_symptoms CASCADE;
+DROP TABLE vaccinations;
 DROP TABLE symptoms_categories CASCADE;
 DROP TABLE symptoms;
 DROP TABLE people;
-DROP TABLE vaccination_totals;
+DROP TABLE doses;
+DROP TABLE age_sex_doses;
+DROP TABLE import_runs;
\ No newline at end of file
@@ -5,5 +5,8 @@ psql -d vax -f ./db/scripts/drop_tables.sql
 psql -d vax -f ./db/tables/people.sql
 psql -d vax -f ./db/tables/symptoms.sql
 psql -d vax -f ./db/tables/people_symptoms.sql
+psql -d vax -f ./db/tables/vaccinations.sql
 psql -d vax -f ./db/tables/symptoms_categories.sql
-psql -d vax -f ./db/tables/vaccination_totals.sql
\ No newline at end of file
+psql -d vax -f ./db/tables/doses.sql
+psql -d vax -f ./db/tables/age_sex_doses.sql
+psql -d vax -f ./db/tables/import_runs.sql
\ No newline at end of file
@@ -1,4 +1,5 @@
 TRUNCATE TABLE people_symptoms CASCADE;
+TRUNCATE TABLE vaccinations CASCADE;
 TRUNCATE TABLE symptoms_categories CASCADE;
 TRUNCATE TABLE symptoms CASCADE;
 TRUNCATE TABLE people CASCADE;
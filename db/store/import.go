@@ -0,0 +1,491 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ImportBatch holds everything parsed from one set of VAERS files, staged in memory before it is bulk loaded
+type ImportBatch struct {
+	// Sources are the names of the reports files the batch was read from, e.g. 2021VAERSDATA.CSV, a merge only removes
+	// the reports of these files
+	Sources        []string
+	Reports        []Report
+	Symptoms       []Symptom
+	PeopleSymptoms []PeopleSymptom
+	Vaccinations   []Vaccination
+	// Doses and AgeSexDoses replace the doses tables in the same transaction, both a swap and a merge, the files they're
+	// read from are a full history on every release
+	Doses       []Doses
+	AgeSexDoses []AgeSexDoses
+}
+
+// PeopleSymptom links a report to a symptom by name, since symptom IDs are only known once the batch is loaded
+type PeopleSymptom struct {
+	VaersID   int64
+	Symptom   string
+	VaccineID int
+}
+
+// TableCount is the number of rows loaded into a table
+type TableCount struct {
+	Table    string        `json:"table"`
+	Rows     int64         `json:"rows"`
+	Duration time.Duration `json:"duration"`
+}
+
+const CreateStagingTablesQuery = `
+CREATE TEMP TABLE staging_people (LIKE people INCLUDING DEFAULTS) ON COMMIT DROP;
+CREATE TEMP TABLE staging_symptoms (name VARCHAR(255) NOT NULL, alias VARCHAR(255) NOT NULL DEFAULT '', slug VARCHAR(255) NOT NULL) ON COMMIT DROP;
+CREATE TEMP TABLE staging_people_symptoms (vaers_id BIGINT NOT NULL, symptom VARCHAR(255) NOT NULL, vaccine_id INT NOT NULL) ON COMMIT DROP;
+CREATE TEMP TABLE staging_symptoms_categories (symptom VARCHAR(255) NOT NULL, category_id BIGINT NOT NULL) ON COMMIT DROP;
+CREATE TEMP TABLE staging_vaccinations (LIKE vaccinations INCLUDING DEFAULTS) ON COMMIT DROP;
+`
+
+const SwapSymptomsQuery = `INSERT INTO symptoms (name, alias, slug)
+SELECT DISTINCT ON (name) name, alias, slug FROM staging_symptoms
+ON CONFLICT (name) DO UPDATE SET alias = EXCLUDED.alias;`
+
+// DedupeSymptomSlugsQuery suffixes the ID to the slugs of newer symptoms whose names slug the same as an older one's,
+// the unique slug constraint is deferred to the end of the import transaction for it
+const DedupeSymptomSlugsQuery = `UPDATE symptoms s SET slug = s.slug || '-' || s.id
+WHERE EXISTS (SELECT 1 FROM symptoms o WHERE o.slug = s.slug AND o.id < s.id);`
+
+const TruncateReportTablesQuery = `TRUNCATE TABLE people_symptoms, symptoms_categories, vaccinations, people;`
+
+// Columns of the people table staged from a Report, in the order copyStagingRows writes them
+const peopleColumns = `vaers_id, age, sex, notes, reported_at, died, life_threatening, er_visit, hospitalized, hospital_days,
+disabled, recovered, birth_defect, office_visit, vaccinated_at, onset_at, onset_days, onset_issue, co_administered, country, state,
+source`
+
+const SwapPeopleQuery = `INSERT INTO people (` + peopleColumns + `)
+SELECT DISTINCT ON (vaers_id) ` + peopleColumns + ` FROM staging_people;`
+
+// Columns of the vaccinations table staged from a Vaccination, in the order copyStagingRows writes them
+const vaccinationColumns = `vaers_id, vaccine_id, vax_type, manufacturer, name, lot, dose_series, route, site`
+
+const SwapVaccinationsQuery = `INSERT INTO vaccinations (` + vaccinationColumns + `)
+SELECT ` + vaccinationColumns + ` FROM staging_vaccinations
+WHERE vaers_id IN (SELECT vaers_id FROM people);`
+
+const SwapPeopleSymptomsQuery = `INSERT INTO people_symptoms (vaers_id, symptom_id, vaccine_id)
+SELECT DISTINCT sps.vaers_id, s.id, sps.vaccine_id FROM staging_people_symptoms sps
+JOIN symptoms s ON s.name = sps.symptom
+JOIN people p ON p.vaers_id = sps.vaers_id;`
+
+const SwapSymptomsCategoriesQuery = `INSERT INTO symptoms_categories (symptom_id, category_id)
+SELECT DISTINCT s.id, ssc.category_id FROM staging_symptoms_categories ssc
+JOIN symptoms s ON s.name = ssc.symptom
+JOIN people_symptoms ps ON ps.symptom_id = s.id;`
+
+// LoadImportBatch copies the batch into temporary staging tables and swaps it into people, symptoms,
+// people_symptoms and symptoms_categories, and replaces the doses, in a single transaction, so readers never see a
+// partial import
+func (d *DB) LoadImportBatch(ctx context.Context, batch ImportBatch) ([]TableCount, error) {
+	tx, err := d.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := stageImportBatch(ctx, tx, batch); err != nil {
+		return nil, err
+	}
+
+	counts, err := execStagedQueries(ctx, tx, []stagedQuery{
+		{"symptoms", SwapSymptomsQuery},
+		{"", DedupeSymptomSlugsQuery},
+		{"", TruncateReportTablesQuery},
+		{"people", SwapPeopleQuery},
+		{"vaccinations", SwapVaccinationsQuery},
+		{"people_symptoms", SwapPeopleSymptomsQuery},
+		{"symptoms_categories", SwapSymptomsCategoriesQuery},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doseCounts, err := replaceDoses(ctx, tx, batch)
+	if err != nil {
+		return nil, err
+	}
+	counts = append(counts, doseCounts...)
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit import transaction: %v", err)
+	}
+
+	return counts, nil
+}
+
+// ImportChanges lists the VAERS IDs an incremental import added, updated or removed
+type ImportChanges struct {
+	Added   []int64
+	Updated []int64
+	Removed []int64
+}
+
+const (
+	ReportAdded   = "added"
+	ReportUpdated = "updated"
+	ReportRemoved = "removed"
+)
+
+// A report has changed if any of its fields differ, or if its set of symptoms and vaccines differs
+const CreateStagingChangesQuery = `
+CREATE INDEX ON staging_people (vaers_id);
+CREATE INDEX ON staging_people_symptoms (vaers_id);
+CREATE INDEX ON staging_vaccinations (vaers_id);
+CREATE TEMP TABLE staging_changes (vaers_id BIGINT PRIMARY KEY, change VARCHAR(10) NOT NULL) ON COMMIT DROP;
+
+INSERT INTO staging_changes (vaers_id, change)
+SELECT sp.vaers_id, 'added' FROM staging_people sp
+LEFT JOIN people p ON p.vaers_id = sp.vaers_id
+WHERE p.vaers_id IS NULL
+UNION ALL
+SELECT sp.vaers_id, 'updated' FROM staging_people sp
+JOIN people p ON p.vaers_id = sp.vaers_id
+WHERE EXISTS (
+	SELECT ` + peopleColumns + ` FROM staging_people WHERE vaers_id = sp.vaers_id
+	EXCEPT
+	SELECT ` + peopleColumns + ` FROM people WHERE vaers_id = sp.vaers_id
+)
+OR EXISTS (
+	(SELECT s.name, ps.vaccine_id FROM people_symptoms ps JOIN symptoms s ON s.id = ps.symptom_id WHERE ps.vaers_id = sp.vaers_id
+	EXCEPT
+	SELECT sps.symptom, sps.vaccine_id FROM staging_people_symptoms sps WHERE sps.vaers_id = sp.vaers_id)
+	UNION ALL
+	(SELECT sps.symptom, sps.vaccine_id FROM staging_people_symptoms sps WHERE sps.vaers_id = sp.vaers_id
+	EXCEPT
+	SELECT s.name, ps.vaccine_id FROM people_symptoms ps JOIN symptoms s ON s.id = ps.symptom_id WHERE ps.vaers_id = sp.vaers_id)
+)
+OR EXISTS (
+	(SELECT ` + vaccinationColumns + ` FROM vaccinations WHERE vaers_id = sp.vaers_id
+	EXCEPT
+	SELECT ` + vaccinationColumns + ` FROM staging_vaccinations WHERE vaers_id = sp.vaers_id)
+	UNION ALL
+	(SELECT ` + vaccinationColumns + ` FROM staging_vaccinations WHERE vaers_id = sp.vaers_id
+	EXCEPT
+	SELECT ` + vaccinationColumns + ` FROM vaccinations WHERE vaers_id = sp.vaers_id)
+);
+`
+
+// A report is removed when it's missing from the file it was imported from, the reports of files outside the batch,
+// like the other years' archives, are left alone
+const InsertRemovedChangesQuery = `INSERT INTO staging_changes (vaers_id, change)
+SELECT p.vaers_id, 'removed' FROM people p
+LEFT JOIN staging_people sp ON sp.vaers_id = p.vaers_id
+WHERE sp.vaers_id IS NULL AND p.source = ANY($1);`
+
+const DeleteChangedPeopleSymptomsQuery = `DELETE FROM people_symptoms WHERE vaers_id IN (
+SELECT vaers_id FROM staging_changes WHERE change IN ('updated', 'removed'));`
+
+const DeleteChangedVaccinationsQuery = `DELETE FROM vaccinations WHERE vaers_id IN (
+SELECT vaers_id FROM staging_changes WHERE change IN ('updated', 'removed'));`
+
+// Updated reports are deleted and inserted again from the staged rows
+const DeleteChangedPeopleQuery = `DELETE FROM people WHERE vaers_id IN (
+SELECT vaers_id FROM staging_changes WHERE change IN ('updated', 'removed'));`
+
+const InsertChangedPeopleQuery = `INSERT INTO people (` + peopleColumns + `)
+SELECT ` + peopleColumns + ` FROM staging_people
+WHERE vaers_id IN (SELECT vaers_id FROM staging_changes WHERE change IN ('added', 'updated'));`
+
+const InsertChangedVaccinationsQuery = `INSERT INTO vaccinations (` + vaccinationColumns + `)
+SELECT ` + vaccinationColumns + ` FROM staging_vaccinations
+WHERE vaers_id IN (SELECT vaers_id FROM staging_changes WHERE change IN ('added', 'updated'));`
+
+const InsertChangedPeopleSymptomsQuery = `INSERT INTO people_symptoms (vaers_id, symptom_id, vaccine_id)
+SELECT DISTINCT sps.vaers_id, s.id, sps.vaccine_id FROM staging_people_symptoms sps
+JOIN staging_changes c ON c.vaers_id = sps.vaers_id AND c.change IN ('added', 'updated')
+JOIN symptoms s ON s.name = sps.symptom;`
+
+const MergeSymptomsCategoriesQuery = `INSERT INTO symptoms_categories (symptom_id, category_id)
+SELECT DISTINCT s.id, ssc.category_id FROM staging_symptoms_categories ssc
+JOIN symptoms s ON s.name = ssc.symptom
+JOIN people_symptoms ps ON ps.symptom_id = s.id
+ON CONFLICT DO NOTHING;`
+
+const SelectStagingChangesQuery = `SELECT vaers_id, change FROM staging_changes ORDER BY change, vaers_id;`
+
+// MergeImportBatch stages the batch like LoadImportBatch, but only adds new reports, updates changed ones and
+// removes reports missing from the batch's files, so a weekly VAERS release can be applied without re-importing from
+// scratch, one archive at a time if need be
+func (d *DB) MergeImportBatch(ctx context.Context, batch ImportBatch) (ImportChanges, []TableCount, error) {
+	var changes ImportChanges
+
+	tx, err := d.conn.Begin(ctx)
+	if err != nil {
+		return changes, nil, fmt.Errorf("failed to begin import transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := stageImportBatch(ctx, tx, batch); err != nil {
+		return changes, nil, err
+	}
+
+	if _, err := tx.Exec(ctx, CreateStagingChangesQuery); err != nil {
+		return changes, nil, fmt.Errorf("failed to compute changed reports: %v", err)
+	}
+	if _, err := tx.Exec(ctx, InsertRemovedChangesQuery, batch.Sources); err != nil {
+		return changes, nil, fmt.Errorf("failed to compute removed reports: %v", err)
+	}
+
+	counts, err := execStagedQueries(ctx, tx, []stagedQuery{
+		{"symptoms", SwapSymptomsQuery},
+		{"", DedupeSymptomSlugsQuery},
+		{"", DeleteChangedPeopleSymptomsQuery},
+		{"", DeleteChangedVaccinationsQuery},
+		{"", DeleteChangedPeopleQuery},
+		{"people", InsertChangedPeopleQuery},
+		{"vaccinations", InsertChangedVaccinationsQuery},
+		{"people_symptoms", InsertChangedPeopleSymptomsQuery},
+		{"symptoms_categories", MergeSymptomsCategoriesQuery},
+	})
+	if err != nil {
+		return changes, nil, err
+	}
+
+	doseCounts, err := replaceDoses(ctx, tx, batch)
+	if err != nil {
+		return changes, nil, err
+	}
+	counts = append(counts, doseCounts...)
+
+	rows, err := tx.Query(ctx, SelectStagingChangesQuery)
+	if err != nil {
+		return changes, nil, fmt.Errorf("failed to fetch changed reports: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vaersID int64
+		var change string
+		if err := rows.Scan(&vaersID, &change); err != nil {
+			return changes, nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+
+		switch change {
+		case ReportAdded:
+			changes.Added = append(changes.Added, vaersID)
+		case ReportUpdated:
+			changes.Updated = append(changes.Updated, vaersID)
+		case ReportRemoved:
+			changes.Removed = append(changes.Removed, vaersID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return changes, nil, fmt.Errorf("failed to read changed reports: %v", err)
+	}
+	rows.Close()
+
+	if err := tx.Commit(ctx); err != nil {
+		return changes, nil, fmt.Errorf("failed to commit import transaction: %v", err)
+	}
+
+	return changes, counts, nil
+}
+
+type stagedQuery struct {
+	// table is empty for queries whose row counts aren't reported
+	table string
+	query string
+}
+
+func execStagedQueries(ctx context.Context, tx pgx.Tx, queries []stagedQuery) ([]TableCount, error) {
+	var counts []TableCount
+
+	for _, q := range queries {
+		start := time.Now()
+		tag, err := tx.Exec(ctx, q.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply staged rows to %s: %v", q.table, err)
+		}
+		if q.table != "" {
+			counts = append(counts, TableCount{Table: q.table, Rows: tag.RowsAffected(), Duration: time.Since(start)})
+		}
+	}
+
+	return counts, nil
+}
+
+func stageImportBatch(ctx context.Context, tx pgx.Tx, batch ImportBatch) error {
+	if _, err := tx.Exec(ctx, CreateStagingTablesQuery); err != nil {
+		return fmt.Errorf("failed to create staging tables: %v", err)
+	}
+
+	people := make([][]interface{}, 0, len(batch.Reports))
+	for _, r := range batch.Reports {
+		people = append(people, []interface{}{r.VaersID, r.Age, string(r.Sex), r.Notes, r.ReportedAt, r.Died, r.LifeThreatening,
+			r.ERVisit, r.Hospitalized, r.HospitalDays, r.Disabled, r.Recovered, r.BirthDefect, r.OfficeVisit, r.VaccinatedAt,
+			r.OnsetAt, r.OnsetDays, string(r.OnsetIssue), r.CoAdministered, r.Country, r.State, r.Source})
+	}
+
+	symptoms := make([][]interface{}, 0, len(batch.Symptoms))
+	var symptomsCategories [][]interface{}
+	for _, s := range batch.Symptoms {
+		symptoms = append(symptoms, []interface{}{s.Name, s.Alias, s.Slug})
+		for _, cID := range s.CategoryIDs {
+			symptomsCategories = append(symptomsCategories, []interface{}{s.Name, cID})
+		}
+	}
+
+	peopleSymptoms := make([][]interface{}, 0, len(batch.PeopleSymptoms))
+	for _, ps := range batch.PeopleSymptoms {
+		peopleSymptoms = append(peopleSymptoms, []interface{}{ps.VaersID, ps.Symptom, ps.VaccineID})
+	}
+
+	vaccinations := make([][]interface{}, 0, len(batch.Vaccinations))
+	for _, v := range batch.Vaccinations {
+		vaccinations = append(vaccinations, []interface{}{v.VaersID, v.VaccineID, v.Type, v.Manufacturer, v.Name, v.Lot, v.DoseSeries, v.Route, v.Site})
+	}
+
+	copies := []struct {
+		table   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{"staging_people", columnNames(peopleColumns), people},
+		{"staging_symptoms", []string{"name", "alias", "slug"}, symptoms},
+		{"staging_people_symptoms", []string{"vaers_id", "symptom", "vaccine_id"}, peopleSymptoms},
+		{"staging_symptoms_categories", []string{"symptom", "category_id"}, symptomsCategories},
+		{"staging_vaccinations", columnNames(vaccinationColumns), vaccinations},
+	}
+
+	for _, c := range copies {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{c.table}, c.columns, pgx.CopyFromRows(c.rows)); err != nil {
+			return fmt.Errorf("failed to copy rows into %s: %v", c.table, err)
+		}
+	}
+
+	return nil
+}
+
+const DeleteDosesQuery = `DELETE FROM doses; DELETE FROM age_sex_doses;`
+
+// replaceDoses replaces the doses time series and their breakdown by sex and age with the batch's, in the import
+// transaction, so the rates never go by doses from another import than the reports
+func replaceDoses(ctx context.Context, tx pgx.Tx, batch ImportBatch) ([]TableCount, error) {
+	if _, err := tx.Exec(ctx, DeleteDosesQuery); err != nil {
+		return nil, fmt.Errorf("failed to delete doses: %v", err)
+	}
+
+	doses := make([][]interface{}, 0, len(batch.Doses))
+	for _, ds := range batch.Doses {
+		doses = append(doses, []interface{}{ds.Date, ds.Location, ds.VaccineID, ds.Total})
+	}
+	ageSexDoses := make([][]interface{}, 0, len(batch.AgeSexDoses))
+	for _, ds := range batch.AgeSexDoses {
+		ageSexDoses = append(ageSexDoses, []interface{}{ds.Date, ds.Location, ds.VaccineID, string(ds.Sex), ds.AgeGroup.Min, ds.AgeGroup.Max, ds.Total})
+	}
+
+	copies := []struct {
+		table   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{"doses", []string{"date", "location", "vaccine_id", "total"}, doses},
+		{"age_sex_doses", []string{"date", "location", "vaccine_id", "sex", "age_min", "age_max", "total"}, ageSexDoses},
+	}
+
+	var counts []TableCount
+	for _, c := range copies {
+		start := time.Now()
+		n, err := tx.CopyFrom(ctx, pgx.Identifier{c.table}, c.columns, pgx.CopyFromRows(c.rows))
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy rows into %s: %v", c.table, err)
+		}
+		counts = append(counts, TableCount{Table: c.table, Rows: n, Duration: time.Since(start)})
+	}
+	return counts, nil
+}
+
+type ImportStatus string
+
+const (
+	ImportRunning   ImportStatus = "running"
+	ImportSucceeded ImportStatus = "succeeded"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// ImportRun records the provenance of one run of the importer
+type ImportRun struct {
+	ID               int64
+	Status           ImportStatus
+	Incremental      bool
+	VaersReleaseDate *time.Time
+	Files            []ImportFile
+	// Skipped counts the rows skipped for each reason
+	Skipped map[string]int
+	// Flagged counts the rows kept with a field left out, for each reason
+	Flagged        map[string]int
+	Tables         []TableCount
+	ReportsAdded   int
+	ReportsUpdated int
+	ReportsRemoved int
+	Error          string
+	StartedAt      time.Time
+	FinishedAt     *time.Time
+}
+
+// ImportFile is a source file read by an import run
+type ImportFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Rows   int    `json:"rows"`
+}
+
+// UpdatedAt is the date the data was last refreshed, the VAERS release date if it's known
+func (r ImportRun) UpdatedAt() time.Time {
+	if r.VaersReleaseDate != nil {
+		return *r.VaersReleaseDate
+	}
+	if r.FinishedAt != nil {
+		return *r.FinishedAt
+	}
+	return time.Time{}
+}
+
+const InsertImportRunQuery = `INSERT INTO import_runs (status, incremental, vaers_release_date, files, started_at)
+VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+
+func (d *DB) StartImportRun(ctx context.Context, run ImportRun) (int64, error) {
+	var id int64
+	err := d.conn.QueryRow(ctx, InsertImportRunQuery, ImportRunning, run.Incremental, run.VaersReleaseDate, run.Files, run.StartedAt).Scan(&id)
+	return id, err
+}
+
+const UpdateImportRunQuery = `UPDATE import_runs SET status = $2, files = $3, skipped = $4, flagged = $5, tables = $6,
+reports_added = $7, reports_updated = $8, reports_removed = $9, error = $10, finished_at = $11
+WHERE id = $1;`
+
+func (d *DB) FinishImportRun(ctx context.Context, run ImportRun) error {
+	_, err := d.conn.Exec(ctx, UpdateImportRunQuery, run.ID, run.Status, run.Files, run.Skipped, run.Flagged, run.Tables,
+		run.ReportsAdded, run.ReportsUpdated, run.ReportsRemoved, run.Error, run.FinishedAt)
+	return err
+}
+
+const SelectLastImportRunQuery = `SELECT id, status, incremental, vaers_release_date, files, skipped, flagged, tables,
+reports_added, reports_updated, reports_removed, error, started_at, finished_at FROM import_runs
+WHERE status = 'succeeded' ORDER BY finished_at DESC LIMIT 1;`
+
+// GetLastImportRun returns the most recent successful import run
+func (d *DB) GetLastImportRun(ctx context.Context) (ImportRun, error) {
+	var run ImportRun
+	err := d.conn.QueryRow(ctx, SelectLastImportRunQuery).Scan(&run.ID, &run.Status, &run.Incremental, &run.VaersReleaseDate,
+		&run.Files, &run.Skipped, &run.Flagged, &run.Tables, &run.ReportsAdded, &run.ReportsUpdated, &run.ReportsRemoved, &run.Error,
+		&run.StartedAt, &run.FinishedAt)
+	return run, err
+}
+
+func columnNames(columns string) []string {
+	names := strings.Split(columns, ",")
+	for i, n := range names {
+		names[i] = strings.TrimSpace(n)
+	}
+	return names
+}
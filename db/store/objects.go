@@ -1,8 +1,12 @@
 package store
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/thehungrysmurf/vax/data"
 )
 
 type Sex string
@@ -36,72 +40,579 @@ func (s *Sex) String() string {
 }
 
 type Report struct {
-	VaersID    int64
-	Age        int
-	Sex        Sex
-	Notes      string
-	ReportedAt time.Time
+	VaersID int64
+	// Age is nil when the report leaves it blank
+	Age             *int
+	Sex             Sex
+	Notes           string
+	ReportedAt      time.Time
+	Died            bool
+	LifeThreatening bool
+	ERVisit         bool
+	Hospitalized    bool
+	HospitalDays    int
+	Disabled        bool
+	// Recovered is nil when the recovery is unknown
+	Recovered   *bool
+	BirthDefect bool
+	OfficeVisit bool
+	// VaccinatedAt and OnsetAt are nil when the report leaves them blank
+	VaccinatedAt *time.Time
+	OnsetAt      *time.Time
+	// OnsetDays is the number of days from vaccination to onset, nil when unknown or flagged with an OnsetIssue
+	OnsetDays  *int
+	OnsetIssue OnsetIssue
+	// CoAdministered is set when the report lists vaccines against more than one illness
+	CoAdministered bool
+	// Country is the ISO code of the country the report comes from, empty when a non domestic report doesn't say
+	Country string
+	// State is the US state, empty when unknown or outside the US
+	State string
+	// Source is the name of the reports file the report was imported from, e.g. 2021VAERSDATA.CSV
+	Source string
 }
 
-type Symptom struct {
-	ID          int64
-	Name        string
-	Alias       string
-	CategoryIDs []int
+// Outcomes are the outcomes ticked on the report, in the order of Outcomes
+func (r Report) Outcomes() []Outcome {
+	return outcomesFromFlags([]bool{r.Died, r.LifeThreatening, r.Hospitalized, r.Disabled, r.BirthDefect, r.ERVisit, r.OfficeVisit})
 }
 
-type Illness string
+// Region is the state of a US report or the country of any other, AnyRegion when the report doesn't say
+func (r Report) Region() Region {
+	if Region(r.Country) == UnitedStates && r.State != "" {
+		return UnitedStates + Region("-"+r.State)
+	}
+	return Region(r.Country)
+}
+
+// Vaccination is one vaccine listed on a report
+type Vaccination struct {
+	VaersID int64
+	// VaccineID is nil for vaccines not in the vaccines table
+	VaccineID    *int
+	Type         string
+	Manufacturer string
+	Name         string
+	Lot          string
+	DoseSeries   string
+	Route        string
+	Site         string
+}
+
+// OnsetIssue flags a report whose vaccination and onset dates contradict each other
+type OnsetIssue string
 
 const (
-	UnknownIllness Illness = "unknown"
-	Covid19                = "covid19"
+	NoOnsetIssue           OnsetIssue = ""
+	OnsetBeforeVaccination OnsetIssue = "onset-before-vaccination"
+	OnsetAfterReport       OnsetIssue = "onset-after-report"
+	VaccinationAfterReport OnsetIssue = "vaccination-after-report"
+	VaccinationBeforeVAERS OnsetIssue = "vaccination-before-vaers"
+	NumDaysMismatch        OnsetIssue = "numdays-mismatch"
 )
 
-type Manufacturer string
+func (o OnsetIssue) String() string {
+	switch o {
+	case OnsetBeforeVaccination:
+		return "Onset before vaccination"
+	case OnsetAfterReport:
+		return "Onset after the report was received"
+	case VaccinationAfterReport:
+		return "Vaccination after the report was received"
+	case VaccinationBeforeVAERS:
+		return "Vaccination before VAERS started"
+	case NumDaysMismatch:
+		return "Days to onset don't match the dates"
+	}
+	return ""
+}
+
+// Outcome is one of the seriousness outcomes ticked on a VAERS report
+type Outcome string
 
 const (
-	UnknownManufacturer Manufacturer = "unknown"
-	Moderna                          = "moderna"
-	Pfizer                           = "pfizer"
-	Janssen                          = "janssen"
+	AnyOutcome      Outcome = ""
+	Died            Outcome = "died"
+	LifeThreatening Outcome = "life-threatening"
+	ERVisit         Outcome = "er-visit"
+	Hospitalized    Outcome = "hospitalized"
+	Disabled        Outcome = "disabled"
+	BirthDefect     Outcome = "birth-defect"
+	OfficeVisit     Outcome = "office-visit"
 )
 
-func ManufacturerFromString(s string) Manufacturer {
-	switch strings.ToLower(s) {
-	case "moderna":
-		return Moderna
-	case `pfizer\biontech`, "pfizer":
-		return Pfizer
-	case "janssen":
-		return Janssen
+// Outcomes in order of seriousness
+var Outcomes = []Outcome{Died, LifeThreatening, Hospitalized, Disabled, BirthDefect, ERVisit, OfficeVisit}
+
+func OutcomeFromString(s string) Outcome {
+	for _, o := range Outcomes {
+		if string(o) == strings.ToLower(s) {
+			return o
+		}
+	}
+	return AnyOutcome
+}
+
+func (o *Outcome) String() string {
+	switch *o {
+	case Died:
+		return "Died"
+	case LifeThreatening:
+		return "Life threatening"
+	case ERVisit:
+		return "ER visit"
+	case Hospitalized:
+		return "Hospitalized"
+	case Disabled:
+		return "Disabled"
+	case BirthDefect:
+		return "Birth defect"
+	case OfficeVisit:
+		return "Doctor's office visit"
 	default:
-		return UnknownManufacturer
+		return "Any outcome"
 	}
 }
 
-func (m *Manufacturer) String() string {
-	switch *m {
-	case Moderna:
-		return "Moderna"
-	case Pfizer:
-		return "Pfizer"
-	case Janssen:
-		return "Johnson & Johnson"
+// column is the people table column flagging the outcome
+func (o Outcome) column() string {
+	switch o {
+	case Died:
+		return "died"
+	case LifeThreatening:
+		return "life_threatening"
+	case ERVisit:
+		return "er_visit"
+	case Hospitalized:
+		return "hospitalized"
+	case Disabled:
+		return "disabled"
+	case BirthDefect:
+		return "birth_defect"
+	case OfficeVisit:
+		return "office_visit"
 	default:
-		return "Unknown"
+		return ""
 	}
 }
 
-type Vaccine struct {
-	Illness      Illness
-	Manufacturer Manufacturer
+// CoAdministration filters reports on whether they list vaccines against other illnesses as well
+type CoAdministration string
+
+const (
+	AnyCoAdministration   CoAdministration = ""
+	OnlyCoAdministered    CoAdministration = "only"
+	ExcludeCoAdministered CoAdministration = "exclude"
+)
+
+var CoAdministrations = []CoAdministration{AnyCoAdministration, OnlyCoAdministered, ExcludeCoAdministered}
+
+func CoAdministrationFromString(s string) CoAdministration {
+	switch CoAdministration(strings.ToLower(s)) {
+	case OnlyCoAdministered:
+		return OnlyCoAdministered
+	case ExcludeCoAdministered:
+		return ExcludeCoAdministered
+	default:
+		return AnyCoAdministration
+	}
+}
+
+func (c *CoAdministration) String() string {
+	switch *c {
+	case OnlyCoAdministered:
+		return "Only with other vaccines"
+	case ExcludeCoAdministered:
+		return "Without other vaccines"
+	default:
+		return "All reports"
+	}
+}
+
+// condition is the extra condition on the people table, aliased p, selecting the reports
+func (c CoAdministration) condition() string {
+	switch c {
+	case OnlyCoAdministered:
+		return "AND p.co_administered"
+	case ExcludeCoAdministered:
+		return "AND NOT p.co_administered"
+	default:
+		return ""
+	}
 }
 
-func (i *Illness) FromString(s string) Illness {
-	switch strings.ToLower(s) {
-	case "covid19":
-		return Covid19
+// Region is where reports come from: everywhere, the US, outside the US, a country code such as GB or a US state such as US-CA
+type Region string
+
+const (
+	AnyRegion    Region = ""
+	UnitedStates Region = "US"
+	OutsideUS    Region = "NON-US"
+)
+
+func RegionFromString(s string) Region {
+	s = strings.ToUpper(s)
+	switch {
+	case Region(s) == UnitedStates || Region(s) == OutsideUS:
+		return Region(s)
+	case strings.HasPrefix(s, string(UnitedStates)+"-"):
+		if _, ok := data.USStates[strings.TrimPrefix(s, string(UnitedStates)+"-")]; ok {
+			return Region(s)
+		}
 	default:
-		return UnknownIllness
+		if _, ok := data.Countries[s]; ok {
+			return Region(s)
+		}
+	}
+	return AnyRegion
+}
+
+func (r Region) String() string {
+	switch {
+	case r == AnyRegion:
+		return "Everywhere"
+	case r == OutsideUS:
+		return "Outside the US"
+	case strings.HasPrefix(string(r), string(UnitedStates)+"-"):
+		return data.USStates[string(r)[3:]] + ", US"
+	default:
+		return data.Countries[string(r)]
+	}
+}
+
+// Code is the region as it's given in query strings, e.g. US-CA, where String is its name
+func (r Region) Code() string {
+	return string(r)
+}
+
+// Country is the ISO code of the region when it's a whole country, empty for everywhere, outside the US and US states
+func (r Region) Country() string {
+	if r == AnyRegion || r == OutsideUS || strings.HasPrefix(string(r), string(UnitedStates)+"-") {
+		return ""
+	}
+	return string(r)
+}
+
+// dosesCondition is the extra condition on the doses table, aliased d, selecting the region's country. It's false
+// for US states, which have no doses on record, and for everywhere and outside the US, whose reports include
+// countries without doses on record and reports not saying the country, which would inflate the rates.
+func (r Region) dosesCondition() (string, bool) {
+	if r.Country() == "" || RegionFromString(string(r)) != r {
+		return "", false
+	}
+	return fmt.Sprintf("AND d.location = '%s'", string(r)), true
+}
+
+// condition is the extra condition on the people table, aliased p, selecting the reports. Only regions known to
+// RegionFromString are inlined in the query, anything else selects every report.
+func (r Region) condition() string {
+	if r == AnyRegion || RegionFromString(string(r)) != r {
+		return ""
+	}
+
+	switch {
+	case r == OutsideUS:
+		return "AND p.country != 'US'"
+	case strings.HasPrefix(string(r), string(UnitedStates)+"-"):
+		return fmt.Sprintf("AND p.country = 'US' AND p.state = '%s'", string(r)[3:])
+	default:
+		return fmt.Sprintf("AND p.country = '%s'", string(r))
+	}
+}
+
+// Filter narrows down the reports counted and listed on the vaccine pages
+type Filter struct {
+	CoAdmin CoAdministration
+	Region  Region
+}
+
+func (f Filter) condition() string {
+	return strings.TrimSpace(f.CoAdmin.condition() + " " + f.Region.condition())
+}
+
+// AgeGroup is an age range of the category pages, both ends included
+type AgeGroup struct {
+	Min int
+	Max int
+}
+
+var AgeGroups = []AgeGroup{{12, 15}, {16, 25}, {26, 39}, {40, 59}, {60, 75}, {76, 89}, {90, 110}}
+
+// AgeGroupOf returns the age group of the age, false when it's outside every group
+func AgeGroupOf(age int) (AgeGroup, bool) {
+	for _, ag := range AgeGroups {
+		if age >= ag.Min && age <= ag.Max {
+			return ag, true
+		}
+	}
+	return AgeGroup{}, false
+}
+
+// AgeGroupFromString parses an age group such as 12-15, returning the zero AgeGroup when it's not one of AgeGroups
+func AgeGroupFromString(s string) AgeGroup {
+	for _, ag := range AgeGroups {
+		if s == ag.String() {
+			return ag
+		}
+	}
+	return AgeGroup{}
+}
+
+func (a AgeGroup) String() string {
+	return fmt.Sprintf("%d-%d", a.Min, a.Max)
+}
+
+func (a AgeGroup) Label() string {
+	if a.Max >= AgeGroups[len(AgeGroups)-1].Max {
+		return fmt.Sprintf("%d+", a.Min)
+	}
+	return fmt.Sprintf("%d - %d", a.Min, a.Max)
+}
+
+// ReportFilter selects the reports listed on a results page, on top of the Filter shared by the vaccine pages
+type ReportFilter struct {
+	// Sex is empty for every sex, UnknownSex selects the reports that don't say
+	Sex Sex
+	// Ages is nil for reports of every age, known or not
+	Ages *AgeGroup
+	// UnknownAge adds the reports without an age to the Ages
+	UnknownAge bool
+	// Categories are category slugs, empty for every category
+	Categories []string
+	Outcome    Outcome
+}
+
+// condition is the extra condition on the people table, aliased p, selecting the reports. Only values known to be
+// valid are inlined, the categories are a query parameter.
+func (rf ReportFilter) condition() string {
+	var conditions []string
+	switch rf.Sex {
+	case Male, Female, UnknownSex:
+		conditions = append(conditions, fmt.Sprintf("AND p.sex = '%s'", rf.Sex))
+	}
+	if rf.Ages != nil {
+		ages := fmt.Sprintf("p.age BETWEEN %d AND %d", rf.Ages.Min, rf.Ages.Max)
+		if rf.UnknownAge {
+			ages = fmt.Sprintf("(%s OR p.age IS NULL)", ages)
+		}
+		conditions = append(conditions, "AND "+ages)
+	}
+	if col := rf.Outcome.column(); col != "" {
+		conditions = append(conditions, "AND p."+col)
+	}
+	return strings.Join(conditions, " ")
+}
+
+// Label describes the sexes and ages selected, e.g. Female, 18 - 64 years
+func (rf ReportFilter) Label() string {
+	sex := "All sexes"
+	if rf.Sex != "" {
+		sex = rf.Sex.String()
+	}
+
+	ages := "all ages"
+	if rf.Ages != nil {
+		ages = rf.Ages.Label() + " years"
+		if rf.UnknownAge {
+			ages += " and unknown ages"
+		}
+	}
+	return sex + ", " + ages
+}
+
+// ReportSort is the order of the reports on a results page
+type ReportSort string
+
+const (
+	SortByDate     ReportSort = "date"
+	SortByAge      ReportSort = "age"
+	SortBySymptoms ReportSort = "symptoms"
+)
+
+var ReportSorts = []ReportSort{SortByDate, SortByAge, SortBySymptoms}
+
+// ReportSortFromString returns the sort named s, false when there's none
+func ReportSortFromString(s string) (ReportSort, bool) {
+	for _, rs := range ReportSorts {
+		if string(rs) == strings.ToLower(s) {
+			return rs, true
+		}
+	}
+	return "", false
+}
+
+func (rs ReportSort) String() string {
+	switch rs {
+	case SortByDate:
+		return "Report date"
+	case SortByAge:
+		return "Age"
+	case SortBySymptoms:
+		return "Number of symptoms"
+	}
+	return ""
+}
+
+// key is the integer the reports are sorted by, unknown ages sort as -1. It's computed on the reports grouped by
+// person, so it may aggregate the symptoms table, aliased s.
+func (rs ReportSort) key() string {
+	switch rs {
+	case SortByAge:
+		return "COALESCE(p.age, -1)"
+	case SortBySymptoms:
+		return "count(DISTINCT s.id)"
+	}
+	return "EXTRACT(EPOCH FROM p.reported_at)::bigint"
+}
+
+// keyset is the condition selecting the reports past the cursor $3, $4 in the direction of cmp. It's on the indexed
+// columns the key is computed from, so the reports are picked before they're grouped, except for the symptom count
+// which is only known after and goes in the HAVING clause.
+func (rs ReportSort) keyset(cmp string) (where, having string) {
+	switch rs {
+	case SortByAge:
+		return fmt.Sprintf("AND (COALESCE(p.age, -1), p.vaers_id) %s ($3, $4)", cmp), ""
+	case SortBySymptoms:
+		return "", fmt.Sprintf("HAVING (count(DISTINCT s.id), p.vaers_id) %s ($3, $4)", cmp)
+	}
+	// Reports are received on a date, so their epoch is a whole number of seconds
+	return fmt.Sprintf("AND (p.reported_at, p.vaers_id) %s (to_timestamp($3), $4)", cmp), ""
+}
+
+// ReportCursor is the position of a report in a sorted list, its sort key then its VAERS ID to break ties
+type ReportCursor struct {
+	Key     int64
+	VaersID int64
+}
+
+// ReportCursorFromString parses a cursor written by String
+func ReportCursorFromString(s string) (ReportCursor, error) {
+	var c ReportCursor
+	parts := strings.SplitN(s, "_", 2)
+	if len(parts) != 2 {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	var err error
+	if c.Key, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	if c.VaersID, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	return c, nil
+}
+
+func (c ReportCursor) String() string {
+	return fmt.Sprintf("%d_%d", c.Key, c.VaersID)
+}
+
+// ReportPage is a page of a sorted report list, the reports After a cursor, or Before it when going back. Both are nil
+// on the first page.
+type ReportPage struct {
+	Sort   ReportSort
+	Desc   bool
+	After  *ReportCursor
+	Before *ReportCursor
+	Size   int
+}
+
+type Symptom struct {
+	ID    int64
+	Name  string
+	Alias string
+	// Slug is the symptom's URL segment, SymptomSlug of the name with a suffix when two names come out the same
+	Slug        string
+	CategoryIDs []int
+}
+
+// SymptomSlug lower cases the MedDRA term and joins its words with dashes, e.g. injection-site-pain
+func SymptomSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			dash = true
+			continue
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+		dash = false
+	}
+	if b.Len() == 0 {
+		return "symptom"
+	}
+	return b.String()
+}
+
+// Covid19 is the slug of the illness the site started with, its pages keep their /vaccine/{vaccine}/ URLs
+const Covid19 = "covid19"
+
+// Illness groups the vaccines against it, matched to VAERS rows by their VAX_TYPE values
+type Illness struct {
+	ID         int
+	Slug       string
+	Name       string
+	VaersTypes []string
+}
+
+// MatchesVAERS reports whether a VAERS vaccine row is against the illness
+func (i Illness) MatchesVAERS(vaxType string) bool {
+	return containsFold(i.VaersTypes, strings.TrimSpace(vaxType))
+}
+
+// Path is the page listing the illness's vaccines, the home page for COVID-19
+func (i Illness) Path() string {
+	if i.Slug == Covid19 {
+		return "/"
+	}
+	return "/illness/" + i.Slug + "/"
+}
+
+// Vaccine is a product shown on the site, matched to VAERS and CDC rows by its spellings there
+type Vaccine struct {
+	ID int
+	// Illness is the slug of the illness
+	Illness string
+	Slug    string
+	Name    string
+	// Logo is the image path, empty when there's no logo
+	Logo string
+	// VaersTypes and VaersManufacturers are the VAX_TYPE and VAX_MANU values of the product, e.g. COVID19-2 for bivalent boosters,
+	// no VaersManufacturers matches every manufacturer
+	VaersTypes         []string
+	VaersManufacturers []string
+	// CDCNames are the vaccine labels in the vaccination totals file, empty when it doesn't break the product out
+	CDCNames []string
+}
+
+// Path is the vaccine's page, COVID-19 vaccines keep the URLs they had before other illnesses were added
+func (v Vaccine) Path() string {
+	if v.Illness == Covid19 {
+		return "/vaccine/" + v.Slug
+	}
+	return "/illness/" + v.Illness + "/vaccine/" + v.Slug
+}
+
+// MatchesVAERS reports whether a VAERS vaccine row is for the product
+func (v Vaccine) MatchesVAERS(vaxType, manufacturer string) bool {
+	if !containsFold(v.VaersTypes, strings.TrimSpace(vaxType)) {
+		return false
+	}
+	return len(v.VaersManufacturers) == 0 || containsFold(v.VaersManufacturers, strings.TrimSpace(manufacturer))
+}
+
+// MatchesCDC reports whether a vaccination totals row is for the product
+func (v Vaccine) MatchesCDC(name string) bool {
+	return containsFold(v.CDCNames, strings.TrimSpace(name))
+}
+
+func containsFold(strs []string, s string) bool {
+	for _, str := range strs {
+		if strings.EqualFold(str, s) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+const SelectReportQuery = `SELECT vaers_id, age, sex, notes, reported_at, died, life_threatening, er_visit, hospitalized,
+hospital_days, disabled, recovered, birth_defect, office_visit, vaccinated_at, onset_at, onset_days, onset_issue,
+co_administered, country, state FROM people WHERE vaers_id = $1`
+
+// GetReport returns the report with the VAERS ID, pgx.ErrNoRows when there's none
+func (d *DB) GetReport(ctx context.Context, vaersID int64) (Report, error) {
+	var r Report
+	var sex, onsetIssue string
+	err := d.conn.QueryRow(ctx, SelectReportQuery, vaersID).Scan(&r.VaersID, &r.Age, &sex, &r.Notes, &r.ReportedAt,
+		&r.Died, &r.LifeThreatening, &r.ERVisit, &r.Hospitalized, &r.HospitalDays, &r.Disabled, &r.Recovered,
+		&r.BirthDefect, &r.OfficeVisit, &r.VaccinatedAt, &r.OnsetAt, &r.OnsetDays, &onsetIssue, &r.CoAdministered,
+		&r.Country, &r.State)
+	r.Sex = Sex(sex)
+	r.OnsetIssue = OnsetIssue(onsetIssue)
+	return r, err
+}
+
+// ReportSymptom is a symptom listed on a report
+type ReportSymptom struct {
+	Symptom
+	Categories []Category
+	// Vaccines are the vaccines on the site the report lists the symptom after, which have a page for it
+	Vaccines []Vaccine
+}
+
+const SelectReportSymptomsQuery = `SELECT s.id, s.name, s.alias, s.slug,
+coalesce((SELECT json_agg(json_build_object('Name', c.name, 'Slug', c.slug) ORDER BY c.name) FROM symptoms_categories sc
+	JOIN categories c ON c.id = sc.category_id WHERE sc.symptom_id = s.id), '[]'),
+json_agg(DISTINCT jsonb_build_object('Illness', v.illness, 'Slug', v.slug, 'Name', v.name))
+FROM people_symptoms ps
+JOIN symptoms s ON s.id = ps.symptom_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE ps.vaers_id = $1
+GROUP BY s.id
+ORDER BY s.name;`
+
+// GetReportSymptoms returns the symptoms of the report with their categories, in alphabetical order
+func (d *DB) GetReportSymptoms(ctx context.Context, vaersID int64) ([]ReportSymptom, error) {
+	var symptoms []ReportSymptom
+	rows, err := d.conn.Query(ctx, SelectReportSymptomsQuery, vaersID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rs := ReportSymptom{}
+		if err := rows.Scan(&rs.ID, &rs.Name, &rs.Alias, &rs.Slug, &rs.Categories, &rs.Vaccines); err != nil {
+			return nil, fmt.Errorf("failed to scan symptom: %v", err)
+		}
+		symptoms = append(symptoms, rs)
+	}
+	return symptoms, rows.Err()
+}
+
+// ReportVaccination is a vaccine listed on a report
+type ReportVaccination struct {
+	Vaccination
+	// Vaccine is the vaccine on the site the row matched, nil when it matched none
+	Vaccine *Vaccine
+}
+
+const SelectReportVaccinationsQuery = `SELECT vc.vaccine_id, vc.vax_type, vc.manufacturer, vc.name, vc.lot, vc.dose_series,
+vc.route, vc.site, v.illness, v.slug, v.name FROM vaccinations vc
+LEFT JOIN vaccines v ON v.id = vc.vaccine_id
+WHERE vc.vaers_id = $1
+ORDER BY vc.id;`
+
+// GetReportVaccinations returns the vaccines listed on the report, in the order of the VAERS file
+func (d *DB) GetReportVaccinations(ctx context.Context, vaersID int64) ([]ReportVaccination, error) {
+	var vaccinations []ReportVaccination
+	rows, err := d.conn.Query(ctx, SelectReportVaccinationsQuery, vaersID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rv := ReportVaccination{Vaccination: Vaccination{VaersID: vaersID}}
+		var illness, slug, name *string
+		if err := rows.Scan(&rv.VaccineID, &rv.Type, &rv.Manufacturer, &rv.Name, &rv.Lot, &rv.DoseSeries, &rv.Route,
+			&rv.Site, &illness, &slug, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan vaccination: %v", err)
+		}
+		if slug != nil {
+			rv.Vaccine = &Vaccine{ID: *rv.VaccineID, Illness: *illness, Slug: *slug, Name: *name}
+		}
+		vaccinations = append(vaccinations, rv)
+	}
+	return vaccinations, rows.Err()
+}
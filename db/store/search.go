@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeadlineStart and HeadlineStop surround the words matching a search in a SearchResult headline. They are control
+// characters so they can't be confused with the notes, which must be escaped before the markers are replaced.
+const (
+	HeadlineStart = "\x02"
+	HeadlineStop  = "\x03"
+)
+
+// headlineOptions are the ts_headline options of the search results, a few fragments of the notes around the matches
+var headlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=3, MaxWords=30, MinWords=10, FragmentDelimiter=\" ... \"", HeadlineStart, HeadlineStop)
+
+type SearchResult struct {
+	VaersID int64
+	// Age is nil when the report doesn't say
+	Age        *int
+	Sex        Sex
+	ReportedAt string
+	// Headline is the part of the notes matching the search, the matched words between HeadlineStart and HeadlineStop
+	Headline string
+	Vaccines []string
+	Outcomes []Outcome
+}
+
+type SearchResults struct {
+	Results []SearchResult
+	// Total counts the matching reports, not only the ones returned
+	Total int64
+	// Prev and Next are nil on the first and the last page
+	Prev *SearchCursor
+	Next *SearchCursor
+}
+
+// SearchCursor is the position of a search result, its rank then its VAERS ID to break ties
+type SearchCursor struct {
+	Rank    float32
+	VaersID int64
+}
+
+// SearchCursorFromString parses a cursor written by String
+func SearchCursorFromString(s string) (SearchCursor, error) {
+	var c SearchCursor
+	parts := strings.SplitN(s, "_", 2)
+	if len(parts) != 2 {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	rank, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil || math.IsNaN(rank) || math.IsInf(rank, 0) {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	c.Rank = float32(rank)
+	if c.VaersID, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	return c, nil
+}
+
+// String writes the rank in as few digits as read back the same
+func (c SearchCursor) String() string {
+	return strconv.FormatFloat(float64(c.Rank), 'g', -1, 32) + "_" + strconv.FormatInt(c.VaersID, 10)
+}
+
+// SearchResultsPage is a page of search results, the results After a cursor, or Before it when going back. Both are
+// nil on the first page.
+type SearchResultsPage struct {
+	After  *SearchCursor
+	Before *SearchCursor
+	Size   int
+}
+
+// searchFrom selects the reports with notes matching the websearch query $1, reported after the vaccine $2 unless it's
+// empty and with symptoms in the categories $3 unless there are none. The report filter condition is added to it.
+const searchFrom = `FROM people p
+WHERE to_tsvector('english', p.notes) @@ websearch_to_tsquery('english', $1)
+AND ($2::text = '' OR EXISTS (
+	SELECT 1 FROM people_symptoms ps
+	JOIN vaccines v ON v.id = ps.vaccine_id
+	WHERE ps.vaers_id = p.vaers_id AND v.slug = $2
+))
+AND (cardinality($3::text[]) = 0 OR EXISTS (
+	SELECT 1 FROM people_symptoms ps
+	JOIN symptoms_categories sc ON sc.symptom_id = ps.symptom_id
+	JOIN categories c ON c.id = sc.category_id
+	WHERE ps.vaers_id = p.vaers_id AND c.slug = ANY($3)
+))
+%s
+`
+
+// The best matches of the page are picked first so only their headlines are computed. The keyset condition, the order
+// and the limit $5 of the page are added around the ranked reports.
+const SearchReportsQuery = `SELECT r.vaers_id, r.age, r.sex, r.reported_at,
+ts_headline('english', r.notes, websearch_to_tsquery('english', $1), $4),
+(SELECT coalesce(json_agg(DISTINCT v.name), '[]') FROM people_symptoms ps
+	JOIN vaccines v ON v.id = ps.vaccine_id WHERE ps.vaers_id = r.vaers_id),
+r.died, r.life_threatening, r.hospitalized, r.disabled, r.birth_defect, r.er_visit, r.office_visit, r.rank FROM (
+SELECT * FROM (
+SELECT p.*, ts_rank(to_tsvector('english', p.notes), websearch_to_tsquery('english', $1)) as rank
+` + searchFrom + `) ranked
+%s
+ORDER BY rank %s, vaers_id %s
+LIMIT $5
+) r
+ORDER BY r.rank %s, r.vaers_id %s;`
+
+const CountSearchReportsQuery = `SELECT count(*) ` + searchFrom
+
+// SearchReports finds the reports with notes matching the query, written as in a web search engine: words, "quoted
+// phrases", or and -excluded words. The vaccine slug may be empty for every vaccine. The best matches come first, the
+// page is found by its keyset like the results pages.
+func (d *DB) SearchReports(ctx context.Context, query, vaccineSlug string, rf ReportFilter, page SearchResultsPage) (SearchResults, error) {
+	var ret SearchResults
+
+	categories := rf.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	size := page.Size
+	if size <= 0 {
+		size = DefaultReportPageSize
+	}
+
+	var err error
+	ret.Total, err = d.count(ctx, fmt.Sprintf(CountSearchReportsQuery, rf.condition()), query, vaccineSlug, categories)
+	if err != nil {
+		return ret, fmt.Errorf("failed to count search results: %v", err)
+	}
+
+	// Going back reads the results backwards from the cursor, the page is put back in order below
+	backwards := page.Before != nil
+	order, cmp := "DESC", "<"
+	if backwards {
+		order, cmp = "ASC", ">"
+	}
+
+	// One more result than the page holds tells whether there's a page after it
+	args := []interface{}{query, vaccineSlug, categories, headlineOptions, size + 1}
+	keyset := ""
+	cursor := page.After
+	if backwards {
+		cursor = page.Before
+	}
+	if cursor != nil {
+		keyset = fmt.Sprintf("WHERE (rank, vaers_id) %s ($6::real, $7)", cmp)
+		args = append(args, cursor.Rank, cursor.VaersID)
+	}
+
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SearchReportsQuery, rf.condition(), keyset, order, order, order, order), args...)
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+
+	var ranks []float32
+	for rows.Next() {
+		sr := SearchResult{}
+		var sex string
+		var reportedAt time.Time
+		var rank float32
+		outcomes := make([]bool, len(Outcomes))
+		dest := []interface{}{&sr.VaersID, &sr.Age, &sex, &reportedAt, &sr.Headline, &sr.Vaccines}
+		for i := range outcomes {
+			dest = append(dest, &outcomes[i])
+		}
+		dest = append(dest, &rank)
+		if err := rows.Scan(dest...); err != nil {
+			return ret, fmt.Errorf("failed to scan search result: %v", err)
+		}
+		sr.Sex = Sex(sex)
+		sr.ReportedAt = reportedAt.Format("2006-01-02")
+		sr.Outcomes = outcomesFromFlags(outcomes)
+
+		ret.Results = append(ret.Results, sr)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, fmt.Errorf("failed to read search results: %v", err)
+	}
+
+	more := len(ret.Results) > size
+	if more {
+		ret.Results = ret.Results[:size]
+		ranks = ranks[:size]
+	}
+	if backwards {
+		for i, j := 0, len(ret.Results)-1; i < j; i, j = i+1, j-1 {
+			ret.Results[i], ret.Results[j] = ret.Results[j], ret.Results[i]
+			ranks[i], ranks[j] = ranks[j], ranks[i]
+		}
+	}
+
+	if n := len(ret.Results); n > 0 {
+		first := &SearchCursor{Rank: ranks[0], VaersID: ret.Results[0].VaersID}
+		last := &SearchCursor{Rank: ranks[n-1], VaersID: ret.Results[n-1].VaersID}
+		if backwards {
+			if more {
+				ret.Prev = first
+			}
+			ret.Next = last
+		} else {
+			if page.After != nil {
+				ret.Prev = first
+			}
+			if more {
+				ret.Next = last
+			}
+		}
+	}
+
+	log.Printf("--> Found %d of %d search results.", len(ret.Results), ret.Total)
+	return ret, nil
+}
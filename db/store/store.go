@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -11,90 +15,310 @@ import (
 )
 
 type Store interface {
-	InsertVaccinationTotals(ctx context.Context, totals VaccinationTotals) error
-	InsertReport(ctx context.Context, r Report) (int64, error)
-	InsertSymptom(ctx context.Context, s Symptom) (int64, error)
-	InsertPeopleSymptoms(ctx context.Context, vaxID int, symID int64)
-	InsertSymptomsCategories(ctx context.Context, symID int, catID int64)
-	GetVaccinationTotals(ctx context.Context) (VaccinationTotals, error)
-	GetVaccineID(ctx context.Context, v Vaccine) (int, error)
+	LoadImportBatch(ctx context.Context, batch ImportBatch) ([]TableCount, error)
+	MergeImportBatch(ctx context.Context, batch ImportBatch) (ImportChanges, []TableCount, error)
+	StartImportRun(ctx context.Context, run ImportRun) (int64, error)
+	FinishImportRun(ctx context.Context, run ImportRun) error
+	GetLastImportRun(ctx context.Context) (ImportRun, error)
+	GetVaccinationTotals(ctx context.Context, location string) (VaccinationTotals, error)
+	GetDosesOverTime(ctx context.Context, illnessSlug, location string) ([]Doses, error)
+	GetDoses(ctx context.Context, vaccineSlug string, filter Filter) (int64, error)
+	GetIllnesses(ctx context.Context) ([]Illness, error)
+	GetIllness(ctx context.Context, slug string) (Illness, error)
+	GetVaccines(ctx context.Context) ([]Vaccine, error)
+	GetVaccine(ctx context.Context, slug string) (Vaccine, error)
 	GetCategoryID(ctx context.Context, cat string) (int, error)
 	GetCategoryName(ctx context.Context, catSlug string) (string, error)
-	GetSymptomCounts(ctx context.Context, manufacturer Manufacturer) ([]CategoryCount, error)
-	GetFilteredResults(ctx context.Context, sex Sex, ageFloor, ageCeiling int, manufacturer Manufacturer, categoryName string) ([]FilteredResult, error)
+	GetCategories(ctx context.Context) ([]Category, error)
+	GetComparison(ctx context.Context, illnessSlug, categorySlug string, sex Sex, ageMin, ageMax int, filter Filter) ([]VaccineComparison, error)
+	GetCategoryCounts(ctx context.Context, vaccineSlug string, filter Filter, doses int64) ([]CategoryCount, error)
+	GetSymptomCounts(ctx context.Context, vaccineSlug string, filter Filter, doses int64) ([]SymptomCount, error)
+	GetLifeThreateningSymptomCounts(ctx context.Context, vaccineSlug string, filter Filter, doses int64) ([]SymptomCount, error)
+	GetFilteredResults(ctx context.Context, vaccineSlug string, rf ReportFilter, page ReportPage, filter Filter) (FilteredResults, error)
+	StreamFilteredResults(ctx context.Context, vaccineSlug string, rf ReportFilter, page ReportPage, filter Filter, fn func(FilteredResult) error) error
+	GetOutcomeCounts(ctx context.Context, vaccineSlug string, filter Filter) ([]OutcomeCount, error)
+	GetCategoryOnsetDistribution(ctx context.Context, vaccineSlug string, filter Filter) ([]OnsetDistribution, error)
+	GetSymptomOnsetDistribution(ctx context.Context, vaccineSlug string, filter Filter) ([]OnsetDistribution, error)
+	GetDoseSymptomCounts(ctx context.Context, vaccineSlug string, filter Filter) ([]DoseSymptomCounts, error)
+	GetLotCounts(ctx context.Context, vaccineSlug string) ([]LotCount, error)
+	GetLotResults(ctx context.Context, vaccineSlug, lot string) ([]FilteredResult, error)
+	GetRegionCounts(ctx context.Context, vaccineSlug string) ([]RegionCount, []RegionCount, error)
+	GetSymptom(ctx context.Context, slug string) (Symptom, error)
+	GetSymptomCategories(ctx context.Context, symptomID int64) ([]Category, error)
+	GetSymptomAgeSexCounts(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) ([]AgeSexCount, error)
+	GetCoReportedSymptoms(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) ([]SymptomCount, error)
+	GetSymptomOnset(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) (OnsetDistribution, error)
+	GetSymptomReports(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) ([]FilteredResult, error)
+	SearchReports(ctx context.Context, query, vaccineSlug string, rf ReportFilter, page SearchResultsPage) (SearchResults, error)
+	GetReport(ctx context.Context, vaersID int64) (Report, error)
+	GetReportSymptoms(ctx context.Context, vaersID int64) ([]ReportSymptom, error)
+	GetReportVaccinations(ctx context.Context, vaersID int64) ([]ReportVaccination, error)
 }
 
 type DB struct {
 	conn *pgx.Conn
+
+	// counts keeps the totals of report lists, shown on every page of a list, by count query and arguments
+	countsMu sync.Mutex
+	counts   map[string]cachedCount
+}
+
+// countTTL is how long the total of a report list is kept, it only changes when the importer runs
+const countTTL = time.Minute
+
+type cachedCount struct {
+	count     int64
+	countedAt time.Time
+}
+
+// VaccinationTotals are the doses administered, by vaccine ID
+type VaccinationTotals map[int]int64
+
+// Doses is the cumulative number of doses of a vaccine administered in a country up to a date
+type Doses struct {
+	Date time.Time
+	// Location is the ISO code of the country
+	Location  string
+	VaccineID int
+	Total     int64
 }
 
-type VaccinationTotals struct {
-	Pfizer  int64
-	Moderna int64
-	Janssen int64
+// AgeSexDoses is the cumulative number of doses of a vaccine administered to people of a sex and age group in a
+// country up to a date, the denominator of the age and sex rates
+type AgeSexDoses struct {
+	Doses
+	Sex      Sex
+	AgeGroup AgeGroup
 }
 
 func NewDB(conn *pgx.Conn) *DB {
 	return &DB{
-		conn: conn,
+		conn:   conn,
+		counts: map[string]cachedCount{},
 	}
 }
 
-const InsertVaccinationTotalsQuery = `INSERT INTO vaccination_totals (pfizer, moderna, janssen, updated_at) values ($1, $2, $3, $4)`
+// count runs a count query, or returns its count from the last countTTL, so paging through a list counts it once
+func (d *DB) count(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	key := fmt.Sprintf("%s%q", query, args)
+	d.countsMu.Lock()
+	defer d.countsMu.Unlock()
+	if c, ok := d.counts[key]; ok && time.Since(c.countedAt) < countTTL {
+		return c.count, nil
+	}
 
-func (d *DB) InsertVaccinationTotals(ctx context.Context, totals VaccinationTotals) error {
-	_, err := d.conn.Exec(ctx, InsertVaccinationTotalsQuery, totals.Pfizer, totals.Moderna, totals.Janssen, time.Now())
-	return err
+	var n int64
+	if err := d.conn.QueryRow(ctx, query, args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	// expired counts are dropped as new ones come in, so the map only holds the last countTTL's lists
+	for k, c := range d.counts {
+		if time.Since(c.countedAt) >= countTTL {
+			delete(d.counts, k)
+		}
+	}
+	d.counts[key] = cachedCount{count: n, countedAt: time.Now()}
+	return n, nil
 }
 
-const SelectVaccinationTotalsQuery = `SELECT pfizer, moderna, janssen FROM vaccination_totals ORDER BY updated_at DESC LIMIT 1`
+const SelectVaccinationTotalsQuery = `SELECT DISTINCT ON (vaccine_id) vaccine_id, total FROM doses WHERE location = $1 ORDER BY vaccine_id, date DESC`
+
+// GetVaccinationTotals returns the latest cumulative doses administered in the country, by vaccine ID
+func (d *DB) GetVaccinationTotals(ctx context.Context, location string) (VaccinationTotals, error) {
+	vt := VaccinationTotals{}
+	rows, err := d.conn.Query(ctx, SelectVaccinationTotalsQuery, location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-func (d *DB) GetVaccinationTotals(ctx context.Context) (VaccinationTotals, error) {
-	var vt VaccinationTotals
-	err := d.conn.QueryRow(ctx, SelectVaccinationTotalsQuery).Scan(&vt.Pfizer, &vt.Moderna, &vt.Janssen)
-	return vt, err
+	for rows.Next() {
+		var vaccineID int
+		var total int64
+		if err := rows.Scan(&vaccineID, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		vt[vaccineID] = total
+	}
+	return vt, rows.Err()
 }
 
-const InsertReportQuery = `INSERT INTO people (vaers_id, age, sex, notes, reported_at) VALUES ($1, $2, $3, $4, $5);`
+const SelectDosesOverTimeQuery = `
+SELECT d.date, d.location, d.vaccine_id, d.total
+FROM doses d
+JOIN vaccines v ON v.id = d.vaccine_id
+WHERE v.illness = $1 AND d.location = $2
+ORDER BY d.date, d.vaccine_id`
 
-func (d *DB) InsertReport(ctx context.Context, r Report) error {
-	_, err := d.conn.Exec(ctx, InsertReportQuery, r.VaersID, r.Age, r.Sex, r.Notes, r.ReportedAt)
-	return err
+// GetDosesOverTime returns the cumulative doses of the illness's vaccines administered in the country, oldest first
+func (d *DB) GetDosesOverTime(ctx context.Context, illnessSlug, location string) ([]Doses, error) {
+	var doses []Doses
+	rows, err := d.conn.Query(ctx, SelectDosesOverTimeQuery, illnessSlug, location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ds Doses
+		if err := rows.Scan(&ds.Date, &ds.Location, &ds.VaccineID, &ds.Total); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		doses = append(doses, ds)
+	}
+	return doses, rows.Err()
 }
 
-const SelectVaccineQuery = `SELECT id FROM vaccines WHERE illness = $1 AND manufacturer = $2;`
+// SelectDosesQuery sums the doses of the vaccine administered in the region's country up to the latest report from it,
+// the %s is the region's condition on the doses
+const SelectDosesQuery = `
+WITH latest_reports AS (
+	SELECT p.country, max(p.reported_at) AS reported_at FROM people p
+	JOIN vaccinations va ON va.vaers_id = p.vaers_id
+	JOIN vaccines v ON v.id = va.vaccine_id
+	WHERE v.slug = $1
+	GROUP BY p.country
+)
+SELECT coalesce(sum(latest.total), 0)::bigint FROM (
+	SELECT DISTINCT ON (d.location) d.total FROM doses d
+	JOIN vaccines v ON v.id = d.vaccine_id
+	JOIN latest_reports lr ON lr.country = d.location
+	WHERE v.slug = $1 AND d.date <= lr.reported_at %s
+	ORDER BY d.location, d.date DESC
+) latest`
 
-func (d *DB) GetVaccineID(ctx context.Context, v Vaccine) (int, error) {
-	var id int
-	err := d.conn.QueryRow(ctx, SelectVaccineQuery, v.Illness, v.Manufacturer).Scan(&id)
-	return id, err
+// GetDoses returns the doses of the vaccine administered in the filter's region up to its latest reports there, the
+// denominator of the rates. It's zero unless the region is a country, see dosesCondition, or when there are none.
+func (d *DB) GetDoses(ctx context.Context, vaccineSlug string, filter Filter) (int64, error) {
+	cond, ok := filter.Region.dosesCondition()
+	if !ok {
+		return 0, nil
+	}
+
+	var total int64
+	if err := d.conn.QueryRow(ctx, fmt.Sprintf(SelectDosesQuery, cond), vaccineSlug).Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
 }
 
-const SelectSymptomQuery = `SELECT id FROM symptoms WHERE name = $1`
-const InsertSymptomQuery = `INSERT INTO symptoms (name, alias) VALUES ($1, $2) RETURNING id;`
+const SelectIllnessDosesQuery = `
+WITH latest_reports AS (
+	SELECT va.vaccine_id, p.country, max(p.reported_at) AS reported_at FROM people p
+	JOIN vaccinations va ON va.vaers_id = p.vaers_id
+	JOIN vaccines v ON v.id = va.vaccine_id
+	WHERE v.illness = $1
+	GROUP BY va.vaccine_id, p.country
+)
+SELECT latest.vaccine_id, sum(latest.total)::bigint FROM (
+	SELECT DISTINCT ON (d.vaccine_id, d.location) d.vaccine_id, d.total FROM doses d
+	JOIN latest_reports lr ON lr.vaccine_id = d.vaccine_id AND lr.country = d.location
+	WHERE d.date <= lr.reported_at %s
+	ORDER BY d.vaccine_id, d.location, d.date DESC
+) latest
+GROUP BY latest.vaccine_id`
 
-func (d *DB) InsertSymptom(ctx context.Context, s Symptom) (int64, error) {
-	var id int64
-	err := d.conn.QueryRow(ctx, SelectSymptomQuery, s.Name).Scan(&id)
-	if err == pgx.ErrNoRows {
-		err = d.conn.QueryRow(ctx, InsertSymptomQuery, s.Name, s.Alias).Scan(&id)
+// getIllnessDoses is GetDoses for every vaccine against the illness at once, by vaccine ID
+func (d *DB) getIllnessDoses(ctx context.Context, illnessSlug string, filter Filter) (VaccinationTotals, error) {
+	vt := VaccinationTotals{}
+	cond, ok := filter.Region.dosesCondition()
+	if !ok {
+		return vt, nil
 	}
 
-	return id, err
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectIllnessDosesQuery, cond), illnessSlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vaccineID int
+		var total int64
+		if err := rows.Scan(&vaccineID, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		vt[vaccineID] = total
+	}
+	return vt, rows.Err()
+}
+
+// perMillion is the number of reports per million doses, zero when the doses are unknown
+func perMillion(count, doses int64) float64 {
+	if doses == 0 {
+		return 0
+	}
+	return float64(count) * 1e6 / float64(doses)
+}
+
+const illnessColumns = `id, slug, name, vaers_types`
+
+const SelectIllnessesQuery = `SELECT ` + illnessColumns + ` FROM illnesses ORDER BY id`
+
+// GetIllnesses returns every illness with vaccines on the site, in the order they were added
+func (d *DB) GetIllnesses(ctx context.Context) ([]Illness, error) {
+	var illnesses []Illness
+	rows, err := d.conn.Query(ctx, SelectIllnessesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanIllness(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		illnesses = append(illnesses, i)
+	}
+	return illnesses, rows.Err()
+}
+
+const SelectIllnessQuery = `SELECT ` + illnessColumns + ` FROM illnesses WHERE slug = $1`
+
+func (d *DB) GetIllness(ctx context.Context, slug string) (Illness, error) {
+	return scanIllness(d.conn.QueryRow(ctx, SelectIllnessQuery, slug))
+}
+
+func scanIllness(row pgx.Row) (Illness, error) {
+	var i Illness
+	err := row.Scan(&i.ID, &i.Slug, &i.Name, &i.VaersTypes)
+	return i, err
 }
 
-const InsertPeopleSymptomQuery = `INSERT INTO people_symptoms(vaers_id, symptom_id, vaccine_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`
+const vaccineColumns = `id, illness, slug, name, logo, vaers_types, vaers_manufacturers, cdc_names`
+
+const SelectVaccinesQuery = `SELECT ` + vaccineColumns + ` FROM vaccines ORDER BY id`
 
-func (d *DB) InsertPeopleSymptom(ctx context.Context, vaersID, symID int64, vaxID int) error {
-	_, err := d.conn.Exec(ctx, InsertPeopleSymptomQuery, vaersID, symID, vaxID)
-	return err
+// GetVaccines returns every vaccine shown on the site, in the order they were added
+func (d *DB) GetVaccines(ctx context.Context) ([]Vaccine, error) {
+	var vaccines []Vaccine
+	rows, err := d.conn.Query(ctx, SelectVaccinesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanVaccine(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		vaccines = append(vaccines, v)
+	}
+	return vaccines, rows.Err()
 }
 
-const InsertSymptomCategoryQuery = `INSERT INTO symptoms_categories (symptom_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+const SelectVaccineQuery = `SELECT ` + vaccineColumns + ` FROM vaccines WHERE slug = $1`
 
-func (d *DB) InsertSymptomCategory(ctx context.Context, symID int64, catID int) error {
-	_, err := d.conn.Exec(ctx, InsertSymptomCategoryQuery, symID, catID)
-	return err
+func (d *DB) GetVaccine(ctx context.Context, slug string) (Vaccine, error) {
+	return scanVaccine(d.conn.QueryRow(ctx, SelectVaccineQuery, slug))
+}
+
+func scanVaccine(row pgx.Row) (Vaccine, error) {
+	var v Vaccine
+	err := row.Scan(&v.ID, &v.Illness, &v.Slug, &v.Name, &v.Logo, &v.VaersTypes, &v.VaersManufacturers, &v.CDCNames)
+	return v, err
 }
 
 const SelectCategoryIDQuery = `SELECT id FROM categories WHERE name = $1`
@@ -113,24 +337,86 @@ func (d *DB) GetCategoryName(ctx context.Context, catSlug string) (string, error
 	return name, err
 }
 
+type Category struct {
+	Name string
+	Slug string
+}
+
+const SelectCategoriesQuery = `SELECT name, slug FROM categories WHERE slug != 'errors-by-medical-staff' ORDER BY name`
+
+func (d *DB) GetCategories(ctx context.Context) ([]Category, error) {
+	var categories []Category
+	rows, err := d.conn.Query(ctx, SelectCategoriesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := Category{}
+		if err := rows.Scan(&c.Name, &c.Slug); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
 type CategoryCount struct {
 	Category     string `db:"category"`
 	CategorySlug string `db:"slug"`
 	Count        int64  `db:"count"`
+	// Rate is the reports per million doses, zero when the filter has no doses to go by
+	Rate float64
+	// AgeSex are the counts by sex and age group, for every group whether or not it has reports
+	AgeSex []AgeSexCount
+}
+
+// AgeSexCount is the number of reports in a category from people of a sex and age group
+type AgeSexCount struct {
+	Sex      Sex
+	AgeGroup AgeGroup
+	Count    int64
+	// Doses are administered to the sex and age group, Doses and Rate are zero when they aren't on record
+	Doses int64
+	Rate  float64
 }
 
-const SelectCategoryCountsQuery = `SELECT c.name as category, c.slug as slug, count(ps.vaers_id) as count FROM categories c
+// Path is the sex and ages of the category page listing the reports, e.g. female/12/15
+func (a AgeSexCount) Path() string {
+	return fmt.Sprintf("%s/%d/%d", strings.ToLower(a.Sex.String()), a.AgeGroup.Min, a.AgeGroup.Max)
+}
+
+func (a AgeSexCount) Label() string {
+	return a.Sex.String() + " " + a.AgeGroup.Label() + " years"
+}
+
+// Queries taking a Filter have a slot for its condition on the people table
+const SelectCategoryCountsQuery = `SELECT c.name as category, c.slug as slug, count(DISTINCT ps.vaers_id) as count FROM categories c
 JOIN symptoms_categories sc ON c.id = sc.category_id
 JOIN symptoms s ON s.id = sc.symptom_id
 JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
 JOIN vaccines v ON v.id = ps.vaccine_id
-WHERE v.manufacturer = $1
+WHERE v.slug = $1
 AND c.slug != 'errors-by-medical-staff'
+%s
 GROUP BY c.name, c.slug;`
 
-func (d *DB) GetCategoryCounts(ctx context.Context, manufacturer Manufacturer) ([]CategoryCount, error) {
+const SelectAgeSexCountsQuery = `SELECT c.slug, p.sex, p.age, count(DISTINCT ps.vaers_id) FROM categories c
+JOIN symptoms_categories sc ON c.id = sc.category_id
+JOIN symptoms s ON s.id = sc.symptom_id
+JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.slug = $1
+AND c.slug != 'errors-by-medical-staff'
+%s
+GROUP BY c.slug, p.sex, p.age;`
+
+func (d *DB) GetCategoryCounts(ctx context.Context, vaccineSlug string, filter Filter, doses int64) ([]CategoryCount, error) {
 	var counts []CategoryCount
-	rows, err := d.conn.Query(ctx, SelectCategoryCountsQuery, manufacturer)
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectCategoryCountsQuery, filter.condition()), vaccineSlug)
 	if err != nil {
 		return nil, err
 	}
@@ -141,84 +427,411 @@ func (d *DB) GetCategoryCounts(ctx context.Context, manufacturer Manufacturer) (
 		if err := rows.Scan(&sc.Category, &sc.CategorySlug, &sc.Count); err != nil {
 			return nil, fmt.Errorf("failed to scan result: %v", err)
 		}
+		sc.Rate = perMillion(sc.Count, doses)
 		counts = append(counts, sc)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ageSex, err := d.getAgeSexCounts(ctx, vaccineSlug, filter)
+	if err != nil {
+		return nil, err
+	}
+	// Without the doses of the whole region there are none of its sexes and ages either
+	ageSexDoses := map[ageSexKey]int64{}
+	if doses > 0 {
+		ageSexDoses, err = d.getAgeSexDoses(ctx, vaccineSlug, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get doses by sex and age: %v", err)
+		}
+	}
+	for i := range counts {
+		for _, sex := range []Sex{Female, Male} {
+			for _, ag := range AgeGroups {
+				key := ageSexKey{sex, ag}
+				count := ageSex[counts[i].CategorySlug][key]
+				counts[i].AgeSex = append(counts[i].AgeSex, AgeSexCount{Sex: sex, AgeGroup: ag, Count: count, Doses: ageSexDoses[key], Rate: perMillion(count, ageSexDoses[key])})
+			}
+		}
+	}
 
 	log.Printf("--> Found category counts: %#+v", counts)
 	return counts, nil
 }
 
+type ageSexKey struct {
+	sex      Sex
+	ageGroup AgeGroup
+}
+
+// getAgeSexCounts counts the reports by category slug, sex and age group, leaving out unknown sexes and ages outside the groups
+func (d *DB) getAgeSexCounts(ctx context.Context, vaccineSlug string, filter Filter) (map[string]map[ageSexKey]int64, error) {
+	counts := map[string]map[ageSexKey]int64{}
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectAgeSexCountsQuery, filter.condition()), vaccineSlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slug, sex string
+		var age *int
+		var count int64
+		if err := rows.Scan(&slug, &sex, &age, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		if age == nil {
+			continue
+		}
+
+		ag, ok := AgeGroupOf(*age)
+		if !ok || (sex != Female && sex != Male) {
+			continue
+		}
+		if counts[slug] == nil {
+			counts[slug] = map[ageSexKey]int64{}
+		}
+		counts[slug][ageSexKey{Sex(sex), ag}] += count
+	}
+	return counts, rows.Err()
+}
+
+// SelectAgeSexDosesQuery is SelectDosesQuery by sex and age group
+const SelectAgeSexDosesQuery = `
+WITH latest_reports AS (
+	SELECT p.country, max(p.reported_at) AS reported_at FROM people p
+	JOIN vaccinations va ON va.vaers_id = p.vaers_id
+	JOIN vaccines v ON v.id = va.vaccine_id
+	WHERE v.slug = $1
+	GROUP BY p.country
+)
+SELECT latest.sex, latest.age_min, latest.age_max, sum(latest.total)::bigint FROM (
+	SELECT DISTINCT ON (d.location, d.sex, d.age_min) d.sex, d.age_min, d.age_max, d.total FROM age_sex_doses d
+	JOIN vaccines v ON v.id = d.vaccine_id
+	JOIN latest_reports lr ON lr.country = d.location
+	WHERE v.slug = $1 AND d.date <= lr.reported_at %s
+	ORDER BY d.location, d.sex, d.age_min, d.date DESC
+) latest
+GROUP BY latest.sex, latest.age_min, latest.age_max`
+
+// getAgeSexDoses returns the doses of the vaccine administered in the filter's region by sex and age group, the
+// denominators of the age and sex rates. It's empty when the region has no doses, see dosesCondition, and leaves out
+// the groups that aren't on record.
+func (d *DB) getAgeSexDoses(ctx context.Context, vaccineSlug string, filter Filter) (map[ageSexKey]int64, error) {
+	doses := map[ageSexKey]int64{}
+	cond, ok := filter.Region.dosesCondition()
+	if !ok {
+		return doses, nil
+	}
+
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectAgeSexDosesQuery, cond), vaccineSlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sex string
+		var ag AgeGroup
+		var total int64
+		if err := rows.Scan(&sex, &ag.Min, &ag.Max, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		doses[ageSexKey{Sex(sex), ag}] = total
+	}
+	return doses, rows.Err()
+}
+
 type FilteredResult struct {
-	Age        int      `db:"age"`
-	ReportedAt string   `db:"reported_at"`
-	Notes      string   `db:"notes"`
-	Symptoms   []string `db:"symptoms"`
+	VaersID int64 `db:"vaers_id"`
+	// Age is nil when the report doesn't say
+	Age        *int      `db:"age"`
+	ReportedAt string    `db:"reported_at"`
+	Notes      string    `db:"notes"`
+	Symptoms   []string  `db:"symptoms"`
+	Outcomes   []Outcome `db:"outcomes"`
+	// DoseSeries is only set for results listed by lot
+	DoseSeries string `db:"dose_series"`
+}
+
+// FilteredResults is a page of reports and the cursors of the pages around it
+type FilteredResults struct {
+	Results []FilteredResult
+	// Total counts the reports on every page
+	Total int64
+	// Prev and Next are nil on the first and the last page
+	Prev *ReportCursor
+	Next *ReportCursor
 }
 
-const SelectFilteredResultsQuery = `SELECT p.age as age, p.reported_at as reported_at, p.notes as notes, json_agg(s.name) as symptoms FROM people p
+// filteredResultsFrom selects the reports of a vaccine, joined to their symptoms in the categories of the report
+// filter. The report filter and the filter conditions are added to it.
+const filteredResultsFrom = `FROM people p
 JOIN people_symptoms ps ON p.vaers_id = ps.vaers_id
 JOIN symptoms s ON s.id = ps.symptom_id
 JOIN symptoms_categories sc ON sc.symptom_id = s.id
 JOIN categories c ON c.id = sc.category_id
 JOIN vaccines v ON v.id = ps.vaccine_id
-WHERE p.sex = $1 
-AND p.age BETWEEN $2 AND $3 
-AND v.manufacturer = $4
-AND c.name = $5
-GROUP BY p.age, p.notes, p.reported_at
-ORDER BY p.age, p.reported_at, json_agg(s.name)::text;
+WHERE v.slug = $1
+AND c.slug != 'errors-by-medical-staff'
+AND (cardinality($2::text[]) = 0 OR c.slug = ANY($2))
+%s
+%s
 `
 
-func (d *DB) GetFilteredResults(ctx context.Context, sex Sex, ageMin, ageMax int, manufacturer Manufacturer, category string) ([]FilteredResult, error) {
-	var results []FilteredResult
-	rows, err := d.conn.Query(ctx, SelectFilteredResultsQuery, sex, ageMin, ageMax, manufacturer, category)
+// The sort key is computed per report, with the keyset condition of the page in the WHERE or the HAVING clause, then
+// the order and the limit of the page are added around it. Only symptoms in the categories are listed.
+const SelectFilteredResultsQuery = `SELECT vaers_id, age, reported_at, notes, symptoms,
+died, life_threatening, hospitalized, disabled, birth_defect, er_visit, office_visit, sort_key FROM (
+SELECT p.vaers_id, p.age, p.reported_at, p.notes, json_agg(DISTINCT s.name) as symptoms,
+p.died, p.life_threatening, p.hospitalized, p.disabled, p.birth_defect, p.er_visit, p.office_visit, %s as sort_key
+` + filteredResultsFrom + `%s
+GROUP BY p.id
+%s
+) r
+ORDER BY sort_key %s, vaers_id %s
+LIMIT %s;
+`
+
+const CountFilteredResultsQuery = `SELECT count(DISTINCT p.id) ` + filteredResultsFrom
+
+// DefaultReportPageSize is the size of a ReportPage that doesn't set one, and of a page of search results
+const DefaultReportPageSize = 50
+
+// GetFilteredResults returns a page of the reports selected by the report filter and the filter. The page is found by
+// its keyset, so going deep into a long list costs no more than the first page.
+func (d *DB) GetFilteredResults(ctx context.Context, vaccineSlug string, rf ReportFilter, page ReportPage, filter Filter) (FilteredResults, error) {
+	var ret FilteredResults
+
+	categories := rf.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	size := page.Size
+	if size <= 0 {
+		size = DefaultReportPageSize
+	}
+
+	var err error
+	ret.Total, err = d.count(ctx, fmt.Sprintf(CountFilteredResultsQuery, rf.condition(), filter.condition()), vaccineSlug, categories)
 	if err != nil {
-		return nil, err
+		return ret, fmt.Errorf("failed to count results: %v", err)
+	}
+
+	// Going back reads the list backwards from the cursor, the page is put back in order below
+	backwards := page.Before != nil
+	desc := page.Desc != backwards
+	order, cmp := "ASC", ">"
+	if desc {
+		order, cmp = "DESC", "<"
+	}
+
+	args := []interface{}{vaccineSlug, categories}
+	where, having := "", ""
+	cursor := page.After
+	if backwards {
+		cursor = page.Before
+	}
+	if cursor != nil {
+		where, having = page.Sort.keyset(cmp)
+		args = append(args, cursor.Key, cursor.VaersID)
+	}
+
+	// One more report than the page holds tells whether there's a page after it
+	query := fmt.Sprintf(SelectFilteredResultsQuery, page.Sort.key(), rf.condition(), filter.condition(), where, having, order, order, strconv.Itoa(size+1))
+	rows, err := d.conn.Query(ctx, query, args...)
+	if err != nil {
+		return ret, err
 	}
 	defer rows.Close()
 
+	var keys []int64
 	for rows.Next() {
-		fr := FilteredResult{}
-		var reportedAt time.Time
-		if err := rows.Scan(&fr.Age, &reportedAt, &fr.Notes, &fr.Symptoms); err != nil {
-			return nil, fmt.Errorf("failed to scan result: %v", err)
+		fr, key, err := scanFilteredResult(rows)
+		if err != nil {
+			return ret, err
 		}
-		fr.ReportedAt = reportedAt.Format("2006-01-02")
+		ret.Results = append(ret.Results, fr)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, fmt.Errorf("failed to read results: %v", err)
+	}
+
+	more := len(ret.Results) > size
+	if more {
+		ret.Results = ret.Results[:size]
+		keys = keys[:size]
+	}
+	if backwards {
+		for i, j := 0, len(ret.Results)-1; i < j; i, j = i+1, j-1 {
+			ret.Results[i], ret.Results[j] = ret.Results[j], ret.Results[i]
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
 
-		// Replace symptoms with their plain English synonyms, if they exist
-		for i, sym := range fr.Symptoms {
-			if alias, ok := data.AliasesMap[sym]; ok {
-				fr.Symptoms[i] = alias
+	if n := len(ret.Results); n > 0 {
+		first := &ReportCursor{Key: keys[0], VaersID: ret.Results[0].VaersID}
+		last := &ReportCursor{Key: keys[n-1], VaersID: ret.Results[n-1].VaersID}
+		if backwards {
+			if more {
+				ret.Prev = first
+			}
+			ret.Next = last
+		} else {
+			if page.After != nil {
+				ret.Prev = first
+			}
+			if more {
+				ret.Next = last
 			}
 		}
+	}
 
-		results = append(results, fr)
+	log.Printf("--> Found %d of %d filtered results.", len(ret.Results), ret.Total)
+	return ret, nil
+}
+
+// StreamFilteredResults calls fn with every report selected by the report filter and the filter, in the order of the
+// page, as they're read from the database. The page's cursors and size are ignored.
+func (d *DB) StreamFilteredResults(ctx context.Context, vaccineSlug string, rf ReportFilter, page ReportPage, filter Filter, fn func(FilteredResult) error) error {
+	categories := rf.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	order := "ASC"
+	if page.Desc {
+		order = "DESC"
 	}
 
-	log.Printf("--> Found %d filtered results.", len(results))
-	return results, nil
+	query := fmt.Sprintf(SelectFilteredResultsQuery, page.Sort.key(), rf.condition(), filter.condition(), "", "", order, order, "ALL")
+	rows, err := d.conn.Query(ctx, query, vaccineSlug, categories)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		fr, _, err := scanFilteredResult(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(fr); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read results: %v", err)
+	}
+
+	log.Printf("--> Streamed %d filtered results.", n)
+	return nil
+}
+
+// scanFilteredResult scans a row of SelectFilteredResultsQuery, returning the report and its sort key
+func scanFilteredResult(rows pgx.Rows) (FilteredResult, int64, error) {
+	fr := FilteredResult{}
+	var reportedAt time.Time
+	var key int64
+	outcomes := make([]bool, len(Outcomes))
+	dest := []interface{}{&fr.VaersID, &fr.Age, &reportedAt, &fr.Notes, &fr.Symptoms}
+	for i := range outcomes {
+		dest = append(dest, &outcomes[i])
+	}
+	dest = append(dest, &key)
+	if err := rows.Scan(dest...); err != nil {
+		return fr, 0, fmt.Errorf("failed to scan result: %v", err)
+	}
+	fr.ReportedAt = reportedAt.Format("2006-01-02")
+
+	fr.Outcomes = outcomesFromFlags(outcomes)
+	fr.Symptoms = symptomAliases(fr.Symptoms)
+	return fr, key, nil
+}
+
+// outcomesFromFlags returns the outcomes set in flags, given in the order of Outcomes
+func outcomesFromFlags(flags []bool) []Outcome {
+	var outcomes []Outcome
+	for i, ok := range flags {
+		if ok {
+			outcomes = append(outcomes, Outcomes[i])
+		}
+	}
+	return outcomes
+}
+
+// Replace symptoms with their plain English synonyms, if they exist
+func symptomAliases(symptoms []string) []string {
+	for i, sym := range symptoms {
+		if alias, ok := data.AliasesMap[sym]; ok {
+			symptoms[i] = alias
+		}
+	}
+	return symptoms
+}
+
+type OutcomeCount struct {
+	Outcome Outcome
+	Count   int64
+}
+
+const SelectOutcomeCountsQuery = `
+SELECT count(*) FILTER (WHERE p.died), count(*) FILTER (WHERE p.life_threatening), count(*) FILTER (WHERE p.hospitalized),
+count(*) FILTER (WHERE p.disabled), count(*) FILTER (WHERE p.birth_defect), count(*) FILTER (WHERE p.er_visit),
+count(*) FILTER (WHERE p.office_visit) FROM people p
+WHERE p.vaers_id IN (
+	SELECT ps.vaers_id FROM people_symptoms ps
+	JOIN vaccines v ON v.id = ps.vaccine_id
+	WHERE v.slug = $1
+)
+%s;
+`
+
+// GetOutcomeCounts counts the reports for the vaccine with each outcome, in the order of Outcomes
+func (d *DB) GetOutcomeCounts(ctx context.Context, vaccineSlug string, filter Filter) ([]OutcomeCount, error) {
+	counts := make([]OutcomeCount, len(Outcomes))
+	dest := make([]interface{}, len(Outcomes))
+	for i, o := range Outcomes {
+		counts[i].Outcome = o
+		dest[i] = &counts[i].Count
+	}
+
+	if err := d.conn.QueryRow(ctx, fmt.Sprintf(SelectOutcomeCountsQuery, filter.condition()), vaccineSlug).Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	log.Printf("--> Found outcome counts: %#+v", counts)
+	return counts, nil
 }
 
 type SymptomCount struct {
 	Symptom  string
+	Slug     string
 	Count    int64
 	Category string
+	// Rate is the reports per million doses, zero when the filter has no doses to go by
+	Rate float64
 }
 
 const SelectSymptomCountQuery = `
-SELECT s.name AS symptom, c.name AS category, count(ps.vaers_id) AS count FROM categories c
+SELECT s.name AS symptom, s.slug AS slug, c.name AS category, count(DISTINCT ps.vaers_id) AS count FROM categories c
 JOIN symptoms_categories sc ON c.id = sc.category_id
 JOIN symptoms s ON s.id = sc.symptom_id
 JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
 JOIN vaccines v ON v.id = ps.vaccine_id
-WHERE v.manufacturer = $1 AND c.slug != 'errors-by-medical-staff'
-GROUP BY s.name, c.name ORDER BY count(ps.vaers_id) DESC
+WHERE v.slug = $1 AND c.slug != 'errors-by-medical-staff'
+%s
+GROUP BY s.name, s.slug, c.name ORDER BY count(DISTINCT ps.vaers_id) DESC
 LIMIT 30;
 `
 
-func (d *DB) GetSymptomCounts(ctx context.Context, manufacturer Manufacturer) ([]SymptomCount, error) {
+func (d *DB) GetSymptomCounts(ctx context.Context, vaccineSlug string, filter Filter, doses int64) ([]SymptomCount, error) {
 	var results []SymptomCount
-	rows, err := d.conn.Query(ctx, SelectSymptomCountQuery, manufacturer)
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectSymptomCountQuery, filter.condition()), vaccineSlug)
 	if err != nil {
 		return nil, err
 	}
@@ -226,9 +839,10 @@ func (d *DB) GetSymptomCounts(ctx context.Context, manufacturer Manufacturer) ([
 
 	for rows.Next() {
 		sc := SymptomCount{}
-		if err := rows.Scan(&sc.Symptom, &sc.Category, &sc.Count); err != nil {
+		if err := rows.Scan(&sc.Symptom, &sc.Slug, &sc.Category, &sc.Count); err != nil {
 			return nil, fmt.Errorf("failed to scan result: %v", err)
 		}
+		sc.Rate = perMillion(sc.Count, doses)
 
 		// Replace symptom with its plain English synonyms, if it exists
 		if alias, ok := data.AliasesMap[sc.Symptom]; ok {
@@ -243,18 +857,20 @@ func (d *DB) GetSymptomCounts(ctx context.Context, manufacturer Manufacturer) ([
 }
 
 const SelectLifeThreateningSymptomCountQuery = `
-SELECT s.name AS symptom, c.name AS category, count(ps.vaers_id) AS count FROM categories c
+SELECT s.name AS symptom, s.slug AS slug, c.name AS category, count(DISTINCT ps.vaers_id) AS count FROM categories c
 JOIN symptoms_categories sc ON c.id = sc.category_id
 JOIN symptoms s ON s.id = sc.symptom_id
 JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
 JOIN vaccines v ON v.id = ps.vaccine_id
-WHERE v.manufacturer = $1 AND c.slug = 'life-threatening'
-GROUP BY s.name, c.name ORDER BY count(ps.vaers_id) DESC
+WHERE v.slug = $1 AND c.slug = 'life-threatening'
+%s
+GROUP BY s.name, s.slug, c.name ORDER BY count(DISTINCT ps.vaers_id) DESC
 `
 
-func (d *DB) GetLifeThreateningSymptomCounts(ctx context.Context, manufacturer Manufacturer) ([]SymptomCount, error) {
+func (d *DB) GetLifeThreateningSymptomCounts(ctx context.Context, vaccineSlug string, filter Filter, doses int64) ([]SymptomCount, error) {
 	var results []SymptomCount
-	rows, err := d.conn.Query(ctx, SelectLifeThreateningSymptomCountQuery, manufacturer)
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectLifeThreateningSymptomCountQuery, filter.condition()), vaccineSlug)
 	if err != nil {
 		return nil, err
 	}
@@ -262,9 +878,10 @@ func (d *DB) GetLifeThreateningSymptomCounts(ctx context.Context, manufacturer M
 
 	for rows.Next() {
 		sc := SymptomCount{}
-		if err := rows.Scan(&sc.Symptom, &sc.Category, &sc.Count); err != nil {
+		if err := rows.Scan(&sc.Symptom, &sc.Slug, &sc.Category, &sc.Count); err != nil {
 			return nil, fmt.Errorf("failed to scan result: %v", err)
 		}
+		sc.Rate = perMillion(sc.Count, doses)
 
 		// Replace symptom with its plain English synonyms, if it exists
 		if alias, ok := data.AliasesMap[sc.Symptom]; ok {
@@ -277,3 +894,468 @@ func (d *DB) GetLifeThreateningSymptomCounts(ctx context.Context, manufacturer M
 	log.Printf("--> Found life threatening symptom counts: %#+v", results)
 	return results, nil
 }
+
+// OnsetBucket is a range of days from vaccination to onset, MaxDays is -1 for the open ended last bucket
+type OnsetBucket struct {
+	Label   string
+	MinDays int
+	MaxDays int
+}
+
+var OnsetBuckets = []OnsetBucket{
+	{"Same day", 0, 0},
+	{"1 day", 1, 1},
+	{"2 - 3 days", 2, 3},
+	{"4 - 7 days", 4, 7},
+	{"1 - 2 weeks", 8, 14},
+	{"2 - 4 weeks", 15, 30},
+	{"1 - 3 months", 31, 90},
+	{"Over 3 months", 91, -1},
+}
+
+// onsetThresholds are the lower bounds of every bucket but the first, for width_bucket
+func onsetThresholds() []int {
+	var thresholds []int
+	for _, b := range OnsetBuckets[1:] {
+		thresholds = append(thresholds, b.MinDays)
+	}
+	return thresholds
+}
+
+// OnsetDistribution counts the reports of a symptom or category in each of the OnsetBuckets
+type OnsetDistribution struct {
+	Name   string
+	Slug   string
+	Counts []int64
+	Total  int64
+}
+
+const SelectCategoryOnsetQuery = `
+SELECT c.name, c.slug, width_bucket(p.onset_days, $2::int[]) AS bucket, count(DISTINCT p.vaers_id) FROM categories c
+JOIN symptoms_categories sc ON c.id = sc.category_id
+JOIN people_symptoms ps ON ps.symptom_id = sc.symptom_id
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.slug = $1 AND c.slug != 'errors-by-medical-staff' AND p.onset_days IS NOT NULL
+%s
+GROUP BY c.name, c.slug, bucket
+ORDER BY c.name;
+`
+
+// GetCategoryOnsetDistribution counts the days from vaccination to onset for each category
+func (d *DB) GetCategoryOnsetDistribution(ctx context.Context, vaccineSlug string, filter Filter) ([]OnsetDistribution, error) {
+	results, err := d.getOnsetDistribution(ctx, fmt.Sprintf(SelectCategoryOnsetQuery, filter.condition()), vaccineSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("--> Found onset distribution for %d categories", len(results))
+	return results, nil
+}
+
+// SelectSymptomOnsetQuery has two slots for the filter's condition, the top symptoms are picked among the filtered
+// reports too
+const SelectSymptomOnsetQuery = `
+WITH top_symptoms AS (
+	SELECT ps.symptom_id FROM people_symptoms ps
+	JOIN people p ON p.vaers_id = ps.vaers_id
+	JOIN symptoms_categories sc ON sc.symptom_id = ps.symptom_id
+	JOIN categories c ON c.id = sc.category_id
+	JOIN vaccines v ON v.id = ps.vaccine_id
+	WHERE v.slug = $1 AND c.slug != 'errors-by-medical-staff'
+	%s
+	GROUP BY ps.symptom_id ORDER BY count(DISTINCT ps.vaers_id) DESC
+	LIMIT 30
+)
+SELECT s.name, s.slug, width_bucket(p.onset_days, $2::int[]) AS bucket, count(DISTINCT p.vaers_id) FROM symptoms s
+JOIN top_symptoms ts ON ts.symptom_id = s.id
+JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.slug = $1 AND p.onset_days IS NOT NULL
+%s
+GROUP BY s.name, s.slug, bucket
+ORDER BY s.name;
+`
+
+// GetSymptomOnsetDistribution counts the days from vaccination to onset for the 30 most reported symptoms
+func (d *DB) GetSymptomOnsetDistribution(ctx context.Context, vaccineSlug string, filter Filter) ([]OnsetDistribution, error) {
+	cond := filter.condition()
+	results, err := d.getOnsetDistribution(ctx, fmt.Sprintf(SelectSymptomOnsetQuery, cond, cond), vaccineSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace symptoms with their plain English synonyms, if they exist
+	for i, od := range results {
+		if alias, ok := data.AliasesMap[od.Name]; ok {
+			results[i].Name = alias
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Total > results[j].Total
+	})
+
+	log.Printf("--> Found onset distribution for %d symptoms", len(results))
+	return results, nil
+}
+
+// getOnsetDistribution collects the rows of name, slug, bucket and count returned by the query, which takes the
+// vaccine slug, the onset thresholds and then args
+func (d *DB) getOnsetDistribution(ctx context.Context, query string, vaccineSlug string, args ...interface{}) ([]OnsetDistribution, error) {
+	var results []OnsetDistribution
+	rows, err := d.conn.Query(ctx, query, append([]interface{}{vaccineSlug, onsetThresholds()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, slug string
+		var bucket int
+		var count int64
+		if err := rows.Scan(&name, &slug, &bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+
+		if len(results) == 0 || results[len(results)-1].Slug != slug {
+			results = append(results, OnsetDistribution{Name: name, Slug: slug, Counts: make([]int64, len(OnsetBuckets))})
+		}
+		od := &results[len(results)-1]
+		od.Counts[bucket] += count
+		od.Total += count
+	}
+
+	return results, rows.Err()
+}
+
+// UnknownDose is the dose series VAERS records when the reporter didn't know it
+const UnknownDose = "UNK"
+
+// DoseSymptomCounts holds the most reported symptoms for one dose of a vaccine series, "7+" for the seventh dose on
+type DoseSymptomCounts struct {
+	Dose    string
+	Reports int64
+	// Symptoms are listed once each, with the names of all their categories as the Category
+	Symptoms []SymptomCount
+}
+
+func (d DoseSymptomCounts) Label() string {
+	switch d.Dose {
+	case "", UnknownDose, "N/A":
+		return "Unknown dose"
+	}
+	return "Dose " + d.Dose
+}
+
+// SelectDoseSymptomCountsQuery has two slots for the filter's condition, the reports of each dose and their symptoms
+// are counted among the filtered reports
+const SelectDoseSymptomCountsQuery = `
+WITH dose_reports AS (
+	SELECT vx.dose_series AS dose, count(DISTINCT vx.vaers_id) AS reports FROM vaccinations vx
+	JOIN people p ON p.vaers_id = vx.vaers_id
+	JOIN vaccines v ON v.id = vx.vaccine_id
+	WHERE v.slug = $1
+	%s
+	GROUP BY vx.dose_series
+), ranked AS (
+	SELECT vx.dose_series AS dose, s.name AS symptom, s.slug AS slug, string_agg(DISTINCT c.name, ', ' ORDER BY c.name) AS category,
+	count(DISTINCT ps.vaers_id) AS count,
+	row_number() OVER (PARTITION BY vx.dose_series ORDER BY count(DISTINCT ps.vaers_id) DESC, s.name) AS rank
+	FROM people_symptoms ps
+	JOIN people p ON p.vaers_id = ps.vaers_id
+	JOIN vaccinations vx ON vx.vaers_id = ps.vaers_id AND vx.vaccine_id = ps.vaccine_id
+	JOIN vaccines v ON v.id = ps.vaccine_id
+	JOIN symptoms s ON s.id = ps.symptom_id
+	JOIN symptoms_categories sc ON sc.symptom_id = s.id
+	JOIN categories c ON c.id = sc.category_id
+	WHERE v.slug = $1 AND c.slug != 'errors-by-medical-staff'
+	%s
+	GROUP BY vx.dose_series, s.name, s.slug
+)
+SELECT dr.dose, dr.reports, r.symptom, r.slug, r.category, r.count FROM dose_reports dr
+JOIN ranked r ON r.dose = dr.dose
+WHERE r.rank <= $2
+ORDER BY dr.dose, r.rank;
+`
+
+// GetDoseSymptomCounts breaks the most reported symptoms down by dose number, to compare first, second and booster doses
+func (d *DB) GetDoseSymptomCounts(ctx context.Context, vaccineSlug string, filter Filter) ([]DoseSymptomCounts, error) {
+	var results []DoseSymptomCounts
+	cond := filter.condition()
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectDoseSymptomCountsQuery, cond, cond), vaccineSlug, 10)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dose string
+		var reports int64
+		sc := SymptomCount{}
+		if err := rows.Scan(&dose, &reports, &sc.Symptom, &sc.Slug, &sc.Category, &sc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+
+		// Replace symptom with its plain English synonyms, if it exists
+		if alias, ok := data.AliasesMap[sc.Symptom]; ok {
+			sc.Symptom = alias
+		}
+
+		if len(results) == 0 || results[len(results)-1].Dose != dose {
+			results = append(results, DoseSymptomCounts{Dose: dose, Reports: reports})
+		}
+		dc := &results[len(results)-1]
+		dc.Symptoms = append(dc.Symptoms, sc)
+	}
+
+	log.Printf("--> Found symptom counts for %d doses", len(results))
+	return results, rows.Err()
+}
+
+type LotCount struct {
+	Lot   string
+	Count int64
+}
+
+const SelectLotCountsQuery = `
+SELECT vx.lot, count(DISTINCT vx.vaers_id) FROM vaccinations vx
+JOIN vaccines v ON v.id = vx.vaccine_id
+WHERE v.slug = $1 AND vx.lot NOT IN ('', 'N/A', 'NA', 'NONE', 'UNK', 'UNKNOWN')
+GROUP BY vx.lot ORDER BY count(DISTINCT vx.vaers_id) DESC, vx.lot
+LIMIT 20;
+`
+
+// GetLotCounts returns the lots with the most reports for the vaccine
+func (d *DB) GetLotCounts(ctx context.Context, vaccineSlug string) ([]LotCount, error) {
+	var results []LotCount
+	rows, err := d.conn.Query(ctx, SelectLotCountsQuery, vaccineSlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		lc := LotCount{}
+		if err := rows.Scan(&lc.Lot, &lc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		results = append(results, lc)
+	}
+
+	log.Printf("--> Found lot counts: %#+v", results)
+	return results, rows.Err()
+}
+
+const SelectLotResultsQuery = `SELECT p.vaers_id as vaers_id, p.age as age, p.reported_at as reported_at, p.notes as notes, json_agg(DISTINCT s.name) as symptoms,
+p.died, p.life_threatening, p.hospitalized, p.disabled, p.birth_defect, p.er_visit, p.office_visit, vx.dose_series FROM vaccinations vx
+JOIN vaccines v ON v.id = vx.vaccine_id
+JOIN people p ON p.vaers_id = vx.vaers_id
+JOIN people_symptoms ps ON ps.vaers_id = vx.vaers_id AND ps.vaccine_id = vx.vaccine_id
+JOIN symptoms s ON s.id = ps.symptom_id
+WHERE v.slug = $1 AND vx.lot = $2
+GROUP BY p.id, vx.id
+ORDER BY p.reported_at, p.vaers_id;
+`
+
+// GetLotResults lists the reports naming the lot of the vaccine, lots are stored upper case. Lot numbers aren't unique
+// across manufacturers, so the lot is only looked up among the vaccine's.
+func (d *DB) GetLotResults(ctx context.Context, vaccineSlug, lot string) ([]FilteredResult, error) {
+	var results []FilteredResult
+	rows, err := d.conn.Query(ctx, SelectLotResultsQuery, vaccineSlug, lot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		fr := FilteredResult{}
+		var reportedAt time.Time
+		outcomes := make([]bool, len(Outcomes))
+		dest := []interface{}{&fr.VaersID, &fr.Age, &reportedAt, &fr.Notes, &fr.Symptoms}
+		for i := range outcomes {
+			dest = append(dest, &outcomes[i])
+		}
+		dest = append(dest, &fr.DoseSeries)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		fr.ReportedAt = reportedAt.Format("2006-01-02")
+		fr.Outcomes = outcomesFromFlags(outcomes)
+		fr.Symptoms = symptomAliases(fr.Symptoms)
+
+		results = append(results, fr)
+	}
+
+	log.Printf("--> Found %d results for lot %s of %s.", len(results), lot, vaccineSlug)
+	return results, rows.Err()
+}
+
+type RegionCount struct {
+	Region Region
+	Count  int64
+}
+
+const SelectRegionCountsQuery = `
+SELECT p.country, p.state, count(*) FROM people p
+WHERE p.vaers_id IN (
+	SELECT ps.vaers_id FROM people_symptoms ps
+	JOIN vaccines v ON v.id = ps.vaccine_id
+	WHERE v.slug = $1
+)
+GROUP BY p.country, p.state;
+`
+
+// GetRegionCounts counts the reports for the vaccine by country, most reported first, and by US state, in state order
+func (d *DB) GetRegionCounts(ctx context.Context, vaccineSlug string) ([]RegionCount, []RegionCount, error) {
+	rows, err := d.conn.Query(ctx, SelectRegionCountsQuery, vaccineSlug)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	countryCounts := map[Region]int64{}
+	var states []RegionCount
+	for rows.Next() {
+		var country, state string
+		var count int64
+		if err := rows.Scan(&country, &state, &count); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+
+		// Skip reports from unknown places, they're only counted in the everywhere and outside the US totals
+		if country == "" || RegionFromString(country) != Region(country) {
+			continue
+		}
+		countryCounts[Region(country)] += count
+
+		if Region(country) == UnitedStates && state != "" {
+			if r := RegionFromString(string(UnitedStates) + "-" + state); r != AnyRegion {
+				states = append(states, RegionCount{Region: r, Count: count})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var countries []RegionCount
+	for r, count := range countryCounts {
+		countries = append(countries, RegionCount{Region: r, Count: count})
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		return countries[i].Count > countries[j].Count
+	})
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Region < states[j].Region
+	})
+
+	log.Printf("--> Found reports from %d countries and %d US states", len(countries), len(states))
+	return countries, states, nil
+}
+
+// VaccineComparison is a vaccine's reports in a category, side by side with the other vaccines against the illness
+type VaccineComparison struct {
+	Vaccine Vaccine
+	Count   int64
+	// Doses and Rate are zero when the filter has no doses to go by
+	Doses int64
+	Rate  float64
+	// Symptoms are the most reported symptoms of the category
+	Symptoms []SymptomCount
+}
+
+// compareSymptoms is the number of symptoms listed for each vaccine on the comparison
+const compareSymptoms = 10
+
+// SelectComparisonQuery counts the category's reports for every vaccine and, in the same pass, for every vaccine and
+// symptom. The rows with a NULL symptom are the vaccine totals.
+const SelectComparisonQuery = `
+SELECT ps.vaccine_id, s.name, s.slug, c.name, count(DISTINCT ps.vaers_id) FROM categories c
+JOIN symptoms_categories sc ON c.id = sc.category_id
+JOIN symptoms s ON s.id = sc.symptom_id
+JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.illness = $1 AND c.slug = $2
+AND ($3::sex IS NULL OR p.sex = $3::sex)
+AND ($4::int = 0 OR p.age >= $4)
+AND ($5::int = 0 OR p.age <= $5)
+%s
+GROUP BY GROUPING SETS ((ps.vaccine_id, c.name), (ps.vaccine_id, c.name, s.name, s.slug))
+ORDER BY ps.vaccine_id, count(DISTINCT ps.vaers_id) DESC`
+
+// GetComparison compares the reports in the category across the vaccines against the illness, in the vaccines' order.
+// An unknown sex and zero ages leave them out of the comparison.
+func (d *DB) GetComparison(ctx context.Context, illnessSlug, categorySlug string, sex Sex, ageMin, ageMax int, filter Filter) ([]VaccineComparison, error) {
+	vaccines, err := d.GetVaccines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaccines: %v", err)
+	}
+
+	doses, err := d.getIllnessDoses(ctx, illnessSlug, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get doses: %v", err)
+	}
+
+	// A NULL sex compares the reports of every sex
+	var sexParam *string
+	if sex == Female || sex == Male {
+		s := string(sex)
+		sexParam = &s
+	}
+
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectComparisonQuery, filter.condition()), illnessSlug, categorySlug, sexParam, ageMin, ageMax)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int64{}
+	symptoms := map[int][]SymptomCount{}
+	for rows.Next() {
+		var vaccineID int
+		var symptom, slug *string
+		sc := SymptomCount{}
+		if err := rows.Scan(&vaccineID, &symptom, &slug, &sc.Category, &sc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+
+		if symptom == nil {
+			counts[vaccineID] = sc.Count
+			continue
+		}
+		if len(symptoms[vaccineID]) == compareSymptoms {
+			continue
+		}
+		sc.Symptom = *symptom
+		sc.Slug = *slug
+		// Replace symptom with its plain English synonyms, if it exists
+		if alias, ok := data.AliasesMap[sc.Symptom]; ok {
+			sc.Symptom = alias
+		}
+		sc.Rate = perMillion(sc.Count, doses[vaccineID])
+		symptoms[vaccineID] = append(symptoms[vaccineID], sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var comparison []VaccineComparison
+	for _, v := range vaccines {
+		if v.Illness != illnessSlug {
+			continue
+		}
+		comparison = append(comparison, VaccineComparison{
+			Vaccine:  v,
+			Count:    counts[v.ID],
+			Doses:    doses[v.ID],
+			Rate:     perMillion(counts[v.ID], doses[v.ID]),
+			Symptoms: symptoms[v.ID],
+		})
+	}
+
+	log.Printf("--> Found comparison: %#+v", comparison)
+	return comparison, nil
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/thehungrysmurf/vax/data"
+)
+
+const SelectSymptomQuery = `SELECT id, name, alias, slug FROM symptoms WHERE slug = $1`
+
+func (d *DB) GetSymptom(ctx context.Context, slug string) (Symptom, error) {
+	var s Symptom
+	err := d.conn.QueryRow(ctx, SelectSymptomQuery, slug).Scan(&s.ID, &s.Name, &s.Alias, &s.Slug)
+	return s, err
+}
+
+const SelectSymptomCategoriesQuery = `SELECT c.name, c.slug FROM categories c
+JOIN symptoms_categories sc ON sc.category_id = c.id
+WHERE sc.symptom_id = $1
+ORDER BY c.name`
+
+func (d *DB) GetSymptomCategories(ctx context.Context, symptomID int64) ([]Category, error) {
+	var categories []Category
+	rows, err := d.conn.Query(ctx, SelectSymptomCategoriesQuery, symptomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := Category{}
+		if err := rows.Scan(&c.Name, &c.Slug); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+const SelectSymptomAgeSexCountsQuery = `SELECT p.sex, p.age, count(DISTINCT ps.vaers_id) FROM people_symptoms ps
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.slug = $1 AND ps.symptom_id = $2
+%s
+GROUP BY p.sex, p.age;`
+
+// GetSymptomAgeSexCounts counts the reports of the symptom by sex and age group, for every group whether or not it has
+// reports, with their rates where the group's doses are on record
+func (d *DB) GetSymptomAgeSexCounts(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) ([]AgeSexCount, error) {
+	doses, err := d.getAgeSexDoses(ctx, vaccineSlug, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get doses by sex and age: %v", err)
+	}
+
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectSymptomAgeSexCountsQuery, filter.condition()), vaccineSlug, symptomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[ageSexKey]int64{}
+	for rows.Next() {
+		var sex string
+		var age *int
+		var count int64
+		if err := rows.Scan(&sex, &age, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		if age == nil {
+			continue
+		}
+
+		ag, ok := AgeGroupOf(*age)
+		if !ok || (sex != Female && sex != Male) {
+			continue
+		}
+		counts[ageSexKey{Sex(sex), ag}] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var results []AgeSexCount
+	for _, sex := range []Sex{Female, Male} {
+		for _, ag := range AgeGroups {
+			key := ageSexKey{sex, ag}
+			results = append(results, AgeSexCount{Sex: sex, AgeGroup: ag, Count: counts[key], Doses: doses[key], Rate: perMillion(counts[key], doses[key])})
+		}
+	}
+	return results, nil
+}
+
+const SelectCoReportedSymptomsQuery = `SELECT s.name, s.slug, count(DISTINCT ps.vaers_id) FROM people_symptoms ps
+JOIN people_symptoms self ON self.vaers_id = ps.vaers_id AND self.vaccine_id = ps.vaccine_id AND self.symptom_id = $2
+JOIN symptoms s ON s.id = ps.symptom_id
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.slug = $1 AND ps.symptom_id != $2
+%s
+GROUP BY s.name, s.slug ORDER BY count(DISTINCT ps.vaers_id) DESC, s.name
+LIMIT 15;`
+
+// GetCoReportedSymptoms returns the symptoms most often listed on the same reports as the symptom
+func (d *DB) GetCoReportedSymptoms(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) ([]SymptomCount, error) {
+	var results []SymptomCount
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectCoReportedSymptomsQuery, filter.condition()), vaccineSlug, symptomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sc := SymptomCount{}
+		if err := rows.Scan(&sc.Symptom, &sc.Slug, &sc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+
+		// Replace symptom with its plain English synonyms, if it exists
+		if alias, ok := data.AliasesMap[sc.Symptom]; ok {
+			sc.Symptom = alias
+		}
+
+		results = append(results, sc)
+	}
+
+	log.Printf("--> Found %d co-reported symptoms", len(results))
+	return results, rows.Err()
+}
+
+const SelectOneSymptomOnsetQuery = `
+SELECT s.name, s.slug, width_bucket(p.onset_days, $2::int[]) AS bucket, count(DISTINCT p.vaers_id) FROM symptoms s
+JOIN people_symptoms ps ON ps.symptom_id = s.id
+JOIN people p ON p.vaers_id = ps.vaers_id
+JOIN vaccines v ON v.id = ps.vaccine_id
+WHERE v.slug = $1 AND s.id = $3 AND p.onset_days IS NOT NULL
+%s
+GROUP BY s.name, s.slug, bucket;
+`
+
+// GetSymptomOnset counts the days from vaccination to onset for the symptom, Total is zero when no report has consistent dates
+func (d *DB) GetSymptomOnset(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) (OnsetDistribution, error) {
+	results, err := d.getOnsetDistribution(ctx, fmt.Sprintf(SelectOneSymptomOnsetQuery, filter.condition()), vaccineSlug, symptomID)
+	if err != nil || len(results) == 0 {
+		return OnsetDistribution{Counts: make([]int64, len(OnsetBuckets))}, err
+	}
+	return results[0], nil
+}
+
+const SelectSymptomReportsQuery = `SELECT p.vaers_id as vaers_id, p.age as age, p.reported_at as reported_at, p.notes as notes, json_agg(DISTINCT s.name) as symptoms,
+p.died, p.life_threatening, p.hospitalized, p.disabled, p.birth_defect, p.er_visit, p.office_visit FROM people p
+JOIN people_symptoms self ON self.vaers_id = p.vaers_id AND self.symptom_id = $2
+JOIN vaccines v ON v.id = self.vaccine_id
+JOIN people_symptoms ps ON ps.vaers_id = p.vaers_id
+JOIN symptoms s ON s.id = ps.symptom_id
+WHERE v.slug = $1 AND p.notes != ''
+%s
+GROUP BY p.id
+ORDER BY p.reported_at DESC, p.vaers_id DESC
+LIMIT 20;
+`
+
+// GetSymptomReports returns a sample of the narratives of reports listing the symptom, the latest ones first
+func (d *DB) GetSymptomReports(ctx context.Context, vaccineSlug string, symptomID int64, filter Filter) ([]FilteredResult, error) {
+	var results []FilteredResult
+	rows, err := d.conn.Query(ctx, fmt.Sprintf(SelectSymptomReportsQuery, filter.condition()), vaccineSlug, symptomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		fr := FilteredResult{}
+		var reportedAt time.Time
+		outcomes := make([]bool, len(Outcomes))
+		dest := []interface{}{&fr.VaersID, &fr.Age, &reportedAt, &fr.Notes, &fr.Symptoms}
+		for i := range outcomes {
+			dest = append(dest, &outcomes[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %v", err)
+		}
+		fr.ReportedAt = reportedAt.Format("2006-01-02")
+
+		fr.Outcomes = outcomesFromFlags(outcomes)
+		fr.Symptoms = symptomAliases(fr.Symptoms)
+
+		results = append(results, fr)
+	}
+
+	log.Printf("--> Found %d symptom reports", len(results))
+	return results, rows.Err()
+}
@@ -0,0 +1,34 @@
+DROP TABLE IF EXISTS age_sex_doses;
+
+CREATE TABLE age_sex_doses(
+
+	id BIGSERIAL
+	    PRIMARY KEY,
+
+	date DATE
+		NOT NULL,
+
+	location VARCHAR(2)
+		NOT NULL,
+
+	vaccine_id INT
+		NOT NULL,
+
+	sex SEX
+		NOT NULL,
+
+	age_min INT
+		NOT NULL,
+
+	age_max INT
+		NOT NULL,
+
+	total BIGINT
+		NOT NULL,
+
+	UNIQUE (date, location, vaccine_id, sex, age_min),
+
+	FOREIGN KEY (vaccine_id) REFERENCES vaccines(id)
+);
+
+CREATE INDEX age_sex_doses_location_vaccine_id_date_idx ON age_sex_doses (location, vaccine_id, date);
@@ -0,0 +1,25 @@
+DROP TABLE IF EXISTS doses;
+
+CREATE TABLE doses(
+
+	id BIGSERIAL
+	    PRIMARY KEY,
+
+	date DATE
+		NOT NULL,
+
+	location VARCHAR(2)
+		NOT NULL,
+
+	vaccine_id INT
+		NOT NULL,
+
+	total BIGINT
+		NOT NULL,
+
+	UNIQUE (date, location, vaccine_id),
+
+	FOREIGN KEY (vaccine_id) REFERENCES vaccines(id)
+);
+
+CREATE INDEX doses_location_vaccine_id_date_idx ON doses (location, vaccine_id, date);
@@ -0,0 +1,31 @@
+DROP TABLE IF EXISTS illnesses CASCADE;
+
+CREATE TABLE illnesses(
+
+	id SERIAL
+		PRIMARY KEY,
+
+	slug VARCHAR(50)
+		NOT NULL
+		UNIQUE,
+
+	name VARCHAR(255)
+		NOT NULL,
+
+	vaers_types TEXT[]
+		NOT NULL
+		DEFAULT '{}',
+
+	created_at TIMESTAMPTZ
+		NOT NULL
+        DEFAULT NOW()
+);
+
+INSERT INTO illnesses (slug, name, vaers_types)
+VALUES ('covid19', 'COVID-19', ARRAY['COVID19', 'COVID19-2']);
+INSERT INTO illnesses (slug, name, vaers_types)
+VALUES ('flu', 'Influenza', ARRAY['FLU3', 'FLU4', 'FLUA3', 'FLUA4', 'FLUC3', 'FLUC4', 'FLUN3', 'FLUN4', 'FLUR3', 'FLUR4', 'FLUX', 'FLU(H1N1)', 'FLUN(H1N1)', 'FLUX(H1N1)']);
+INSERT INTO illnesses (slug, name, vaers_types)
+VALUES ('hpv', 'HPV', ARRAY['HPV2', 'HPV4', 'HPV9', 'HPVX']);
+INSERT INTO illnesses (slug, name, vaers_types)
+VALUES ('shingles', 'Shingles', ARRAY['VARZOS']);
\ No newline at end of file
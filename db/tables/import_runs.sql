@@ -0,0 +1,62 @@
+DROP TABLE IF EXISTS import_runs;
+DROP TYPE IF EXISTS IMPORT_STATUS;
+
+CREATE TYPE IMPORT_STATUS AS ENUM ('running', 'succeeded', 'failed');
+
+CREATE TABLE import_runs(
+
+	id BIGSERIAL
+		PRIMARY KEY,
+
+	status IMPORT_STATUS
+		NOT NULL
+		DEFAULT 'running',
+
+	incremental BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	vaers_release_date DATE,
+
+	files JSONB
+		NOT NULL
+		DEFAULT '[]',
+
+	skipped JSONB
+		NOT NULL
+		DEFAULT '{}',
+
+	flagged JSONB
+		NOT NULL
+		DEFAULT '{}',
+
+	tables JSONB
+		NOT NULL
+		DEFAULT '[]',
+
+	reports_added INT
+		NOT NULL
+		DEFAULT 0,
+
+	reports_updated INT
+		NOT NULL
+		DEFAULT 0,
+
+	reports_removed INT
+		NOT NULL
+		DEFAULT 0,
+
+	error VARCHAR
+		NOT NULL
+		DEFAULT '',
+
+	started_at TIMESTAMPTZ
+		NOT NULL
+		DEFAULT NOW(),
+
+	finished_at TIMESTAMPTZ,
+
+	created_at TIMESTAMPTZ
+		NOT NULL
+		DEFAULT NOW()
+);
@@ -11,9 +11,7 @@ CREATE TABLE people(
 	vaers_id BIGINT
 		NOT NULL,
 
-	age INT
-		NOT NULL
-		DEFAULT 0,
+	age INT,
 
 	sex SEX
 		NOT NULL
@@ -27,9 +25,79 @@ CREATE TABLE people(
 		NOT NULL
         DEFAULT NOW(),
 
+	died BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	life_threatening BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	er_visit BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	hospitalized BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	hospital_days INT
+		NOT NULL
+		DEFAULT 0,
+
+	disabled BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	recovered BOOLEAN,
+
+	birth_defect BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	office_visit BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	vaccinated_at DATE,
+
+	onset_at DATE,
+
+	onset_days INT,
+
+	onset_issue VARCHAR(50)
+		NOT NULL
+		DEFAULT '',
+
+	co_administered BOOLEAN
+		NOT NULL
+		DEFAULT FALSE,
+
+	country VARCHAR(2)
+		NOT NULL
+		DEFAULT '',
+
+	state VARCHAR(2)
+		NOT NULL
+		DEFAULT '',
+
+	source VARCHAR(255)
+		NOT NULL
+		DEFAULT '',
+
     created_at TIMESTAMPTZ
     	NOT NULL
         DEFAULT NOW(),
 
     UNIQUE(vaers_id)
 );
+
+-- Full text search over the report narratives, queries must use the same to_tsvector expression
+CREATE INDEX people_notes_search_idx ON people USING GIN (to_tsvector('english', notes));
+
+-- Reports of the files an incremental import reads, the others are left alone
+CREATE INDEX people_source_idx ON people (source);
+
+-- Keysets of the results pages sorted by report date or by age, the expressions must match ReportSort.keyset
+CREATE INDEX people_reported_at_keyset_idx ON people (reported_at, vaers_id);
+CREATE INDEX people_age_keyset_idx ON people ((COALESCE(age, -1)), vaers_id);
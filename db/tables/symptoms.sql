@@ -12,9 +12,14 @@ CREATE TABLE symptoms(
 		NOT NULL
 		DEFAULT '',
 
+	slug VARCHAR(255)
+		NOT NULL,
+
 	created_at TIMESTAMPTZ
 		NOT NULL
         DEFAULT NOW(),
 
-    UNIQUE(name)
+    UNIQUE(name),
+
+    UNIQUE(slug) DEFERRABLE INITIALLY DEFERRED
 );
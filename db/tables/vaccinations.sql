@@ -0,0 +1,46 @@
+DROP TABLE IF EXISTS vaccinations;
+
+CREATE TABLE vaccinations(
+
+	id BIGSERIAL
+		PRIMARY KEY,
+
+	vaers_id BIGINT
+		NOT NULL,
+
+	vaccine_id INT,
+
+	vax_type VARCHAR(50)
+		NOT NULL
+		DEFAULT '',
+
+	manufacturer VARCHAR(255)
+		NOT NULL
+		DEFAULT '',
+
+	name VARCHAR(255)
+		NOT NULL
+		DEFAULT '',
+
+	lot VARCHAR(255)
+		NOT NULL
+		DEFAULT '',
+
+	dose_series VARCHAR(10)
+		NOT NULL
+		DEFAULT '',
+
+	route VARCHAR(10)
+		NOT NULL
+		DEFAULT '',
+
+	site VARCHAR(10)
+		NOT NULL
+		DEFAULT '',
+
+	FOREIGN KEY (vaers_id) REFERENCES people(vaers_id),
+	FOREIGN KEY (vaccine_id) REFERENCES vaccines(id)
+);
+
+CREATE INDEX vaccinations_vaers_id_idx ON vaccinations (vaers_id);
+CREATE INDEX vaccinations_lot_idx ON vaccinations (lot);
\ No newline at end of file
@@ -1,24 +1,61 @@
 DROP TABLE IF EXISTS vaccines CASCADE;
 
 DROP TYPE IF EXISTS ILLNESS;
-CREATE TYPE ILLNESS AS ENUM ('covid19');
 
 CREATE TABLE vaccines(
 
 	id SERIAL
 		PRIMARY KEY,
 
-	illness ILLNESS
-		NOT NULL,
+	illness VARCHAR(50)
+		NOT NULL
+		REFERENCES illnesses(slug),
+
+	slug VARCHAR(255)
+		NOT NULL
+		UNIQUE,
 
-	manufacturer VARCHAR(255)
+	name VARCHAR(255)
 		NOT NULL,
 
+	logo VARCHAR(255)
+		NOT NULL
+		DEFAULT '',
+
+	vaers_types TEXT[]
+		NOT NULL
+		DEFAULT '{}',
+
+	vaers_manufacturers TEXT[]
+		NOT NULL
+		DEFAULT '{}',
+
+	cdc_names TEXT[]
+		NOT NULL
+		DEFAULT '{}',
+
 	created_at TIMESTAMPTZ
 		NOT NULL
         DEFAULT NOW()
 );
 
-INSERT INTO vaccines (illness, manufacturer) VALUES ('covid19', 'moderna');
-INSERT INTO vaccines (illness, manufacturer) VALUES ('covid19', 'pfizer');
-INSERT INTO vaccines (illness, manufacturer) VALUES ('covid19', 'janssen');
+INSERT INTO vaccines (illness, slug, name, logo, vaers_types, vaers_manufacturers, cdc_names)
+VALUES ('covid19', 'moderna', 'Moderna', '/assets/images/moderna_logo_resized.jpg', ARRAY['COVID19'], ARRAY['MODERNA'], ARRAY['Moderna']);
+INSERT INTO vaccines (illness, slug, name, logo, vaers_types, vaers_manufacturers, cdc_names)
+VALUES ('covid19', 'pfizer', 'Pfizer', '/assets/images/pfizer_logo_resized.jpg', ARRAY['COVID19'], ARRAY['PFIZER\BIONTECH'], ARRAY['Pfizer/BioNTech']);
+INSERT INTO vaccines (illness, slug, name, logo, vaers_types, vaers_manufacturers, cdc_names)
+VALUES ('covid19', 'janssen', 'Johnson & Johnson', '/assets/images/j_and_j_logo_resized.png', ARRAY['COVID19'], ARRAY['JANSSEN'], ARRAY['Johnson&Johnson']);
+INSERT INTO vaccines (illness, slug, name, logo, vaers_types, vaers_manufacturers, cdc_names)
+VALUES ('covid19', 'novavax', 'Novavax', '', ARRAY['COVID19'], ARRAY['NOVAVAX'], ARRAY['Novavax']);
+INSERT INTO vaccines (illness, slug, name, logo, vaers_types, vaers_manufacturers)
+VALUES ('covid19', 'moderna-bivalent', 'Moderna bivalent', '/assets/images/moderna_logo_resized.jpg', ARRAY['COVID19-2'], ARRAY['MODERNA']);
+INSERT INTO vaccines (illness, slug, name, logo, vaers_types, vaers_manufacturers)
+VALUES ('covid19', 'pfizer-bivalent', 'Pfizer bivalent', '/assets/images/pfizer_logo_resized.jpg', ARRAY['COVID19-2'], ARRAY['PFIZER\BIONTECH']);
+INSERT INTO vaccines (illness, slug, name, vaers_types)
+VALUES ('flu', 'influenza', 'Influenza', ARRAY['FLU3', 'FLU4', 'FLUA3', 'FLUA4', 'FLUC3', 'FLUC4', 'FLUN3', 'FLUN4', 'FLUR3', 'FLUR4', 'FLUX', 'FLU(H1N1)', 'FLUN(H1N1)', 'FLUX(H1N1)']);
+INSERT INTO vaccines (illness, slug, name, vaers_types)
+VALUES ('hpv', 'gardasil', 'Gardasil', ARRAY['HPV4', 'HPV9', 'HPVX']);
+INSERT INTO vaccines (illness, slug, name, vaers_types, vaers_manufacturers)
+VALUES ('shingles', 'shingrix', 'Shingrix', ARRAY['VARZOS'], ARRAY['GLAXOSMITHKLINE BIOLOGICALS']);
+INSERT INTO vaccines (illness, slug, name, vaers_types, vaers_manufacturers)
+VALUES ('shingles', 'zostavax', 'Zostavax', ARRAY['VARZOS'], ARRAY['MERCK & CO. INC.']);
\ No newline at end of file
@@ -17,65 +17,170 @@ import (
 	"github.com/thehungrysmurf/vax/db/store"
 )
 
-const Covid19 = "covid19"
-
 var NonSymptomKeyWords = []string{"normal", "increased", "decreased", "count", "negative", "positive", "magnetic resonance imaging", "x-ray", "tomogram", "test", "examination", "rate", "percentage", "vitamin"}
 
 type Importer interface {
 	Run() error
-	ReadVaccinationTotalsFile() error
-	ReadReportsFile() error
-	ReadVaccinesFile() (map[int64]bool, error)
-	ReadSymptomsFile() (map[string]int, error)
+	ReadVaccinationTotalsFile(ctx context.Context, batch *store.ImportBatch) error
+	ReadReportsFile(ctx context.Context, summaryMap map[int64]*Summary, batch *store.ImportBatch) error
+	ReadVaccinesFile(ctx context.Context, summaryMap map[int64]*Summary, batch *store.ImportBatch) (map[int64]bool, error)
+	ReadSymptomsFile(ctx context.Context, vaccineMap map[int64]bool, summaryMap map[int64]*Summary, batch *store.ImportBatch) (map[string]int, error)
 }
 
 type CSVImporter struct {
-	VaccinationTotalsFilePath string
-	ReportsFilePath           string
-	VaccinesFilePath          string
-	SymptomsFilePath          string
-	DBClient                  *store.DB
+	VaccinationTotalsFile Source
+	// AgeSexDosesFile is the doses by sex and age group the age and sex rates go by, such as the CDC's demographic
+	// series, none when its Path is empty
+	AgeSexDosesFile Source
+	// VAERS files, one of each per yearly or non domestic release
+	ReportsFiles  []Source
+	VaccinesFiles []Source
+	SymptomsFiles []Source
+	DBClient      *store.DB
+	// Incremental merges the files into the existing data instead of replacing it
+	Incremental bool
+	// ChangelogFilePath is where an incremental import writes the VAERS IDs it added, updated and removed
+	ChangelogFilePath string
+	// VaersReleaseDate is the date VAERS published the files, if known
+	VaersReleaseDate *time.Time
+
+	run *store.ImportRun
 }
 
 type Summary struct {
-	Symptoms  []store.Symptom
-	VaccineID int
+	Symptoms []store.Symptom
+	// VaccineIDs are the distinct vaccines from the vaccines table listed on the report, e.g. a primary dose and a booster
+	VaccineIDs []int
+	// CoAdministered is set when the report lists vaccines against more than one illness
+	CoAdministered bool
 }
 
+// NewCSVImporter imports VAERS csv files already extracted to disk
 func NewCSVImporter(vaccinationTotalsFilePath, reportsFilePath, vaccinesFilePath, symptomsFilePath string, dbClient *store.DB) CSVImporter {
 	return CSVImporter{
-		VaccinationTotalsFilePath: vaccinationTotalsFilePath,
-		ReportsFilePath:           reportsFilePath,
-		VaccinesFilePath:          vaccinesFilePath,
-		SymptomsFilePath:          symptomsFilePath,
-		DBClient:                  dbClient,
+		VaccinationTotalsFile: FileSource(vaccinationTotalsFilePath, false),
+		ReportsFiles:          []Source{FileSource(reportsFilePath, true)},
+		VaccinesFiles:         []Source{FileSource(vaccinesFilePath, true)},
+		SymptomsFiles:         []Source{FileSource(symptomsFilePath, true)},
+		DBClient:              dbClient,
 	}
 }
 
+// NewArchiveImporter imports VAERS zip archives, or directories of them, as published by VAERS
+func NewArchiveImporter(vaccinationTotalsFilePath string, archivePaths []string, dbClient *store.DB) (CSVImporter, error) {
+	reports, vaccines, symptoms, err := DiscoverArchives(archivePaths)
+	if err != nil {
+		return CSVImporter{}, err
+	}
+
+	return CSVImporter{
+		VaccinationTotalsFile: FileSource(vaccinationTotalsFilePath, false),
+		ReportsFiles:          reports,
+		VaccinesFiles:         vaccines,
+		SymptomsFiles:         symptoms,
+		DBClient:              dbClient,
+	}, nil
+}
+
+// Run imports the files and records the run, whether it succeeded or failed, in the import_runs table
 func (i CSVImporter) Run() error {
-	summaryMap := map[int64]*Summary{}
 	ctx := context.Background()
 
-	err := i.ReadVaccinationTotalsFile(ctx)
+	i.run = &store.ImportRun{
+		Incremental:      i.Incremental,
+		VaersReleaseDate: i.VaersReleaseDate,
+		Skipped:          map[string]int{},
+		Flagged:          map[string]int{},
+		StartedAt:        time.Now(),
+	}
+
+	id, err := i.DBClient.StartImportRun(ctx, *i.run)
+	if err != nil {
+		return fmt.Errorf("failed to start import run: %v", err)
+	}
+	i.run.ID = id
+
+	err = i.load(ctx)
+
+	finishedAt := time.Now()
+	i.run.FinishedAt = &finishedAt
+	i.run.Status = store.ImportSucceeded
+	if err != nil {
+		i.run.Status = store.ImportFailed
+		i.run.Error = err.Error()
+	}
+
+	if finishErr := i.DBClient.FinishImportRun(ctx, *i.run); finishErr != nil {
+		log.Printf("failed to record import run %d: %v", i.run.ID, finishErr)
+		if err == nil {
+			err = finishErr
+		}
+	}
+
+	printCounts(os.Stdout, "Skipped", i.run.Skipped)
+	printCounts(os.Stdout, "Flagged", i.run.Flagged)
+
+	return err
+}
+
+// printCounts writes the rows counted for each reason under the title, in the reasons' order so runs can be diffed,
+// nothing when there are none
+func printCounts(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "%-25s %10d\n", reason, counts[reason])
+	}
+}
+
+func (i CSVImporter) load(ctx context.Context) error {
+	summaryMap := map[int64]*Summary{}
+	batch := &store.ImportBatch{}
+	start := time.Now()
+
+	sources := []Source{i.VaccinationTotalsFile}
+	if i.AgeSexDosesFile.Path != "" {
+		sources = append(sources, i.AgeSexDosesFile)
+	}
+	sources = append(sources, i.VaccinesFiles...)
+	sources = append(sources, i.ReportsFiles...)
+	sources = append(sources, i.SymptomsFiles...)
+	checksums := map[string]string{}
+	for _, src := range sources {
+		if err := i.addFile(src, checksums); err != nil {
+			log.Printf("failed to checksum file %s: %v", src.Name(), err)
+			return err
+		}
+	}
+
+	err := i.ReadVaccinationTotalsFile(ctx, batch)
 	if err != nil {
-		log.Fatalf("failed to read vaccination totals file: %v", err)
+		log.Printf("failed to read vaccination totals file: %v", err)
 		return err
 	}
 
-	vaccineMap, err := i.ReadVaccinesFile(ctx, summaryMap)
+	vaccineMap, err := i.ReadVaccinesFile(ctx, summaryMap, batch)
 	if err != nil {
-		log.Fatalf("failed to read vaccines file: %v", err)
+		log.Printf("failed to read vaccines file: %v", err)
 		return err
 	}
 
-	if err := i.ReadReportsFile(ctx, summaryMap); err != nil {
-		log.Fatalf("failed to read reports file: %v", err)
+	if err := i.ReadReportsFile(ctx, summaryMap, batch); err != nil {
+		log.Printf("failed to read reports file: %v", err)
 		return err
 	}
 
-	symptomsMap, err := i.ReadSymptomsFile(ctx, vaccineMap, summaryMap)
+	symptomsMap, err := i.ReadSymptomsFile(ctx, vaccineMap, summaryMap, batch)
 	if err != nil {
-		log.Fatalf("failed to read symptoms file: %v", err)
+		log.Printf("failed to read symptoms file: %v", err)
 		return err
 	}
 
@@ -104,306 +209,650 @@ func (i CSVImporter) Run() error {
 		fmt.Printf("\"%s\": {},\n", ns)
 	}
 
-	// for id, s := range summaryMap {
-	// 	log.Printf("complete summary map, vaersID: %v, summary: %+v", id, *s)
-	// }
-
-	// Populate people_symptoms, symptoms_categories
+	// Stage people_symptoms rows, symptoms_categories rows are derived from the staged symptoms
 	for vaersID, summary := range summaryMap {
 		for _, symptom := range summary.Symptoms {
-			if err := i.DBClient.InsertPeopleSymptom(ctx, vaersID, symptom.ID, summary.VaccineID); err != nil {
-				log.Printf("failed to insert people symptoms row for vaers_id: %v, symptom_id: %v, vaccine_id: %v %v", vaersID, symptom.ID, summary.VaccineID, err)
-				continue
+			for _, vaccineID := range summary.VaccineIDs {
+				batch.PeopleSymptoms = append(batch.PeopleSymptoms, store.PeopleSymptom{
+					VaersID:   vaersID,
+					Symptom:   symptom.Name,
+					VaccineID: vaccineID,
+				})
 			}
+		}
+	}
+	log.Printf("finished reading files in %v, loading %d reports, %d vaccinations, %d symptoms, %d people symptoms", time.Since(start), len(batch.Reports), len(batch.Vaccinations), len(batch.Symptoms), len(batch.PeopleSymptoms))
+
+	loadStart := time.Now()
+	var counts []store.TableCount
+	if i.Incremental {
+		var changes store.ImportChanges
+		changes, counts, err = i.DBClient.MergeImportBatch(ctx, *batch)
+		if err != nil {
+			log.Printf("failed to merge import batch: %v", err)
+			return err
+		}
 
-			for _, cID := range symptom.CategoryIDs {
-				if err := i.DBClient.InsertSymptomCategory(ctx, symptom.ID, cID); err != nil {
-					log.Printf("failed to insert symptoms categories row for vaers_id: %v, symptom_id: %v, category_id: %v %v", vaersID, symptom.ID, cID, err)
-					continue
-				}
+		i.run.ReportsAdded = len(changes.Added)
+		i.run.ReportsUpdated = len(changes.Updated)
+		i.run.ReportsRemoved = len(changes.Removed)
+		fmt.Printf("Reports added: %d, updated: %d, removed: %d\n", len(changes.Added), len(changes.Updated), len(changes.Removed))
+		if i.ChangelogFilePath != "" {
+			if err := writeChangelog(i.ChangelogFilePath, changes); err != nil {
+				log.Printf("failed to write changelog: %v", err)
+				return err
 			}
 		}
+	} else {
+		counts, err = i.DBClient.LoadImportBatch(ctx, *batch)
+		if err != nil {
+			log.Printf("failed to load import batch: %v", err)
+			return err
+		}
+	}
+
+	i.run.Tables = counts
+	fmt.Printf("Rows loaded in %v:\n", time.Since(loadStart))
+	for _, c := range counts {
+		fmt.Printf("%-20s %10d rows %10v\n", c.Table, c.Rows, c.Duration)
 	}
+	log.Printf("finished import in %v", time.Since(start))
 
 	return nil
 }
 
-// Parse vaccination totals file, insert into vaccination_totals table
-func (i CSVImporter) ReadVaccinationTotalsFile(ctx context.Context) error {
-	csvFile, err := os.Open(i.VaccinationTotalsFilePath)
+// Parse vaccination totals file, the OWID time series of doses by location, date and vaccine, and the doses by sex and
+// age group into the batch, which replaces the doses tables with them
+func (i CSVImporter) ReadVaccinationTotalsFile(ctx context.Context, batch *store.ImportBatch) error {
+	vaccines, err := i.DBClient.GetVaccines(ctx)
 	if err != nil {
-		log.Printf("failed to open csv vaccination totals file: %v", err)
+		log.Printf("failed to get vaccines: %v", err)
 		return err
 	}
 
-	reader := csv.NewReader(bufio.NewReader(csvFile))
-	linesRead := 0
-	var vaxTotal store.VaccinationTotals
+	// The file names locations the way OWID does, aggregates such as "European Union" have no code and are left out
+	countryCodes := map[string]string{}
+	for code, name := range data.Countries {
+		countryCodes[name] = code
+	}
 
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Printf("failed to read from vaccination totals csv file: %v", err)
-			return err
+	type dosesKey struct {
+		date      time.Time
+		location  string
+		vaccineID int
+	}
+	totals := map[dosesKey]int64{}
+
+	rows, err := readCSV(i.VaccinationTotalsFile, func(line []string) error {
+		location, ok := countryCodes[line[0]]
+		if !ok {
+			return nil
 		}
-		linesRead++
 
-		if linesRead > 1 {
-			if line[0] == "United States" {
-				if line[2] == `Pfizer/BioNTech` {
-					pfizerTotal, err := strconv.ParseInt(line[3], 10, 64)
-					if err != nil {
-						log.Printf("failed to convert pfizer count %s to int: %v", line[0], err)
-						continue
-					}
-					vaxTotal.Pfizer = pfizerTotal
-				}
+		for _, v := range vaccines {
+			if !v.MatchesCDC(line[2]) {
+				continue
+			}
 
-				if line[2] == "Moderna" {
-					modernaTotal, err := strconv.ParseInt(line[3], 10, 64)
-					if err != nil {
-						log.Printf("failed to convert moderna count %s to int: %v", line[0], err)
-						continue
-					}
-					vaxTotal.Moderna = modernaTotal
-				}
+			date, err := time.Parse("2006-01-02", line[1])
+			if err != nil {
+				i.skip("invalid dose date", "failed to parse %s date %s: %v", v.Slug, line[1], err)
+				return nil
+			}
 
-				if line[2] == "Johnson&Johnson" {
-					janssenTotal, err := strconv.ParseInt(line[3], 10, 64)
-					if err != nil {
-						log.Printf("failed to convert j&j count %s to int: %v", line[0], err)
-						continue
-					}
-					vaxTotal.Janssen = janssenTotal
-				}
+			total, err := strconv.ParseInt(line[3], 10, 64)
+			if err != nil {
+				i.skip("invalid dose count", "failed to convert %s count %s to int: %v", v.Slug, line[3], err)
+				return nil
 			}
+			// A product listed under several labels adds up
+			totals[dosesKey{date, location, v.ID}] += total
 		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to read from vaccination totals csv file %s: %v", i.VaccinationTotalsFile.Name(), err)
+		return err
 	}
 
-	if err := i.DBClient.InsertVaccinationTotals(ctx, vaxTotal); err != nil {
-		log.Printf("failed to insert latest vaccination totals: %v", err)
+	doses := make([]store.Doses, 0, len(totals))
+	for k, total := range totals {
+		doses = append(doses, store.Doses{Date: k.date, Location: k.location, VaccineID: k.vaccineID, Total: total})
 	}
+	i.countRows(i.VaccinationTotalsFile, rows)
+	log.Printf("finished reading vaccination totals file, read %d rows, %d doses", rows, len(doses))
+
+	batch.Doses = doses
 
-	log.Printf("finished reading vaccination totals file, read %d lines", linesRead)
+	if i.AgeSexDosesFile.Path != "" {
+		batch.AgeSexDoses, err = i.readAgeSexDoses(vaccines, countryCodes)
+		if err != nil {
+			log.Printf("failed to read from age and sex doses csv file %s: %v", i.AgeSexDosesFile.Name(), err)
+			return err
+		}
+	}
 	return nil
 }
 
-// Parse vaccines file, insert into vaccines table, set VaccineID in summary map
-func (i CSVImporter) ReadVaccinesFile(ctx context.Context, summaryMap map[int64]*Summary) (map[int64]bool, error) {
-	csvFile, err := os.Open(i.VaccinesFilePath)
+// readAgeSexDoses parses the age and sex doses file, the time series of doses by location, date, vaccine, sex and age
+// group, its columns location, date, vaccine, sex, ages and total_vaccinations. Locations and vaccines are named like
+// in the vaccination totals file, sexes F or M and ages one of the age groups, e.g. 16-25.
+func (i CSVImporter) readAgeSexDoses(vaccines []store.Vaccine, countryCodes map[string]string) ([]store.AgeSexDoses, error) {
+	type dosesKey struct {
+		date      time.Time
+		location  string
+		vaccineID int
+		sex       store.Sex
+		ageGroup  store.AgeGroup
+	}
+	totals := map[dosesKey]int64{}
+
+	rows, err := readCSV(i.AgeSexDosesFile, func(line []string) error {
+		location, ok := countryCodes[line[0]]
+		if !ok {
+			return nil
+		}
+
+		sex := store.SexFromString(strings.TrimSpace(line[3]))
+		ag := store.AgeGroupFromString(strings.TrimSpace(line[4]))
+		if sex == store.UnknownSex || ag == (store.AgeGroup{}) {
+			i.skip("unknown dose sex or ages", "unknown dose sex %s or ages %s", line[3], line[4])
+			return nil
+		}
+
+		for _, v := range vaccines {
+			if !v.MatchesCDC(line[2]) {
+				continue
+			}
+
+			date, err := time.Parse("2006-01-02", line[1])
+			if err != nil {
+				i.skip("invalid dose date", "failed to parse %s date %s: %v", v.Slug, line[1], err)
+				return nil
+			}
+
+			total, err := strconv.ParseInt(line[5], 10, 64)
+			if err != nil {
+				i.skip("invalid dose count", "failed to convert %s count %s to int: %v", v.Slug, line[5], err)
+				return nil
+			}
+			totals[dosesKey{date, location, v.ID, sex, ag}] += total
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("failed to open csv vaccines file: %v", err)
 		return nil, err
 	}
 
-	reader := csv.NewReader(bufio.NewReader(csvFile))
-	linesRead := 0
+	doses := make([]store.AgeSexDoses, 0, len(totals))
+	for k, total := range totals {
+		doses = append(doses, store.AgeSexDoses{
+			Doses:    store.Doses{Date: k.date, Location: k.location, VaccineID: k.vaccineID, Total: total},
+			Sex:      k.sex,
+			AgeGroup: k.ageGroup,
+		})
+	}
+	i.countRows(i.AgeSexDosesFile, rows)
+	log.Printf("finished reading age and sex doses file, read %d rows, %d doses", rows, len(doses))
+	return doses, nil
+}
+
+// Parse vaccines files, set VaccineIDs in summary map and stage every vaccine listed on a report with a known vaccine
+func (i CSVImporter) ReadVaccinesFile(ctx context.Context, summaryMap map[int64]*Summary, batch *store.ImportBatch) (map[int64]bool, error) {
 	vaccineMap := map[int64]bool{}
+	// Reports can list other vaccines given at the same visit, before or after the one we track
+	vaccinations := map[int64][]store.Vaccination{}
 
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Printf("failed to read from vaccines csv file: %v", err)
-			return nil, err
-		}
-		linesRead++
+	illnesses, err := i.DBClient.GetIllnesses(ctx)
+	if err != nil {
+		log.Printf("failed to get illnesses: %v", err)
+		return nil, err
+	}
 
-		if linesRead > 1 {
-			if strings.ToLower(line[1]) == Covid19 {
-				id, err := strconv.ParseInt(line[0], 10, 64)
-				if err != nil {
-					log.Printf("failed to convert ID %s to int: %v", line[0], err)
-					continue
-				}
-				vaccineMap[id] = true
+	vaccines, err := i.DBClient.GetVaccines(ctx)
+	if err != nil {
+		log.Printf("failed to get vaccines: %v", err)
+		return nil, err
+	}
 
-				manufacturer := store.ManufacturerFromString(line[2])
+	for _, src := range i.VaccinesFiles {
+		rows, err := readCSV(src, func(line []string) error {
+			id, err := strconv.ParseInt(line[0], 10, 64)
+			if err != nil {
+				i.skip("invalid vaers_id", "failed to convert ID %s to int: %v", line[0], err)
+				return nil
+			}
 
-				// Ignore unknown vaccines
-				if manufacturer != store.Pfizer && manufacturer != store.Moderna && manufacturer != store.Janssen {
-					continue
-				}
+			vaccination := store.Vaccination{
+				VaersID:      id,
+				Type:         strings.TrimSpace(line[1]),
+				Manufacturer: strings.TrimSpace(line[2]),
+				Lot:          strings.ToUpper(strings.TrimSpace(line[3])),
+				DoseSeries:   strings.ToUpper(strings.TrimSpace(line[4])),
+				Route:        strings.TrimSpace(line[5]),
+				Site:         strings.TrimSpace(line[6]),
+				Name:         strings.TrimSpace(line[7]),
+			}
 
-				v := store.Vaccine{
-					Illness:      Covid19,
-					Manufacturer: manufacturer,
+			var vaccineID int
+			for _, v := range vaccines {
+				if v.MatchesVAERS(line[1], line[2]) {
+					vaccineID = v.ID
+					vaccination.VaccineID = &vaccineID
+					break
 				}
+			}
+			vaccinations[id] = append(vaccinations[id], vaccination)
 
-				vaccineID, err := i.DBClient.GetVaccineID(ctx, v)
-				if err != nil {
-					log.Printf("failed to get vaccine ID for vaers_id %v: %v", line[0], err)
-					continue
-				}
+			if illnessOf(illnesses, line[1]) == "" {
+				return nil
+			}
+			vaccineMap[id] = true
 
-				vaersID, err := strconv.ParseInt(line[0], 10, 64)
-				if err != nil {
-					log.Printf("failed to convert vaers_id %q to int64, skipping row: %v", line[0], err)
-					continue
-				}
+			// Ignore vaccines that aren't in the vaccines table
+			if vaccineID == 0 {
+				i.skip("unknown vaccine", "")
+				return nil
+			}
+
+			summary, ok := summaryMap[id]
+			if !ok {
+				summary = &Summary{}
+				summaryMap[id] = summary
+			}
+			if !containsID(summary.VaccineIDs, vaccineID) {
+				summary.VaccineIDs = append(summary.VaccineIDs, vaccineID)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("failed to read from vaccines csv file %s: %v", src.Name(), err)
+			return nil, err
+		}
+
+		i.countRows(src, rows)
+		log.Printf("finished reading vaccines file %s, read %d rows", src.Name(), rows)
+	}
+
+	for id, vs := range vaccinations {
+		summary, ok := summaryMap[id]
+		if !ok {
+			continue
+		}
 
-				summaryMap[vaersID] = &Summary{VaccineID: vaccineID}
+		// VAX_TYPE values outside the illnesses table stand for their own illness
+		seen := map[string]bool{}
+		for _, v := range vs {
+			illness := illnessOf(illnesses, v.Type)
+			if illness == "" {
+				illness = strings.ToUpper(v.Type)
 			}
+			seen[illness] = true
 		}
+		summary.CoAdministered = len(seen) > 1
+		batch.Vaccinations = append(batch.Vaccinations, vs...)
 	}
 
-	log.Printf("finished reading vaccines file, read %d lines", linesRead)
 	return vaccineMap, nil
 }
 
-// Parse reports file, insert into people table
-func (i CSVImporter) ReadReportsFile(ctx context.Context, summaryMap map[int64]*Summary) error {
-	csvFile, err := os.Open(i.ReportsFilePath)
-	if err != nil {
-		log.Printf("failed to open reports csv file: %v", err)
-		return err
-	}
+// Parse reports files, stage rows for the people table
+func (i CSVImporter) ReadReportsFile(ctx context.Context, summaryMap map[int64]*Summary, batch *store.ImportBatch) error {
+	seen := map[int64]bool{}
 
-	reader := csv.NewReader(bufio.NewReader(csvFile))
-	linesRead := 0
+	for _, src := range i.ReportsFiles {
+		batch.Sources = append(batch.Sources, src.FileName())
+		rows, err := readCSV(src, func(line []string) error {
+			vaersID, err := strconv.ParseInt(line[0], 10, 64)
+			if err != nil {
+				i.skip("invalid vaers_id", "failed to convert vaers_id %q to int64, skipping row: %v", line[0], err)
+				return nil
+			}
 
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Printf("failed to read from reports csv file: %v", err)
+			if seen[vaersID] {
+				i.skip("duplicate report", "duplicate vaers_id %v, skipping row", vaersID)
+				return nil
+			}
+
+			// Add to DB only if the report lists a vaccine we track
+			summary, ok := summaryMap[vaersID]
+			if !ok {
+				return nil
+			}
+
+			// AGE_YRS is blank when the reporter didn't give an age, the age is then left unknown
+			var age *int
+			if line[3] != "" {
+				years, err := strconv.ParseFloat(line[3], 0)
+				if err != nil {
+					i.skip("invalid age", "failed to convert age %q to int64, skipping row: %v", line[3], err)
+					return nil
+				}
+				a := int(years)
+				age = &a
+			}
+
+			reportedAt, err := time.Parse("01/02/2006", line[1])
+			if err != nil {
+				i.skip("invalid received date", "failed to convert reportedAt %q to time format, skipping row: %v", line[1], err)
+				return nil
+			}
+
+			// HOSPDAYS is often blank or free text even when HOSPITAL is ticked
+			hospitalDays, _ := strconv.Atoi(line[14])
+
+			vaccinatedAt := parseDate(line[18])
+			onsetAt := parseDate(line[19])
+			onsetDays, onsetIssue := onset(vaccinatedAt, onsetAt, line[20], reportedAt)
+			if onsetIssue != store.NoOnsetIssue {
+				// The report is kept, only its time to onset is left out
+				i.flag(fmt.Sprintf("time to onset: %s", onsetIssue))
+			}
+
+			country, state := string(store.UnitedStates), strings.ToUpper(strings.TrimSpace(line[2]))
+			if src.NonDomestic {
+				country, state = countryFromSplitType(line[28]), ""
+			}
+			if _, ok := data.USStates[state]; !ok {
+				state = ""
+			}
+
+			r := store.Report{
+				VaersID:         vaersID,
+				Age:             age,
+				Sex:             store.SexFromString(line[6]),
+				Notes:           line[8],
+				ReportedAt:      reportedAt,
+				Died:            line[9] == "Y",
+				LifeThreatening: line[11] == "Y",
+				ERVisit:         line[12] == "Y" || line[33] == "Y",
+				Hospitalized:    line[13] == "Y",
+				HospitalDays:    hospitalDays,
+				Disabled:        line[16] == "Y",
+				Recovered:       recovered(line[17]),
+				BirthDefect:     line[31] == "Y",
+				OfficeVisit:     line[32] == "Y",
+				VaccinatedAt:    vaccinatedAt,
+				OnsetAt:         onsetAt,
+				OnsetDays:       onsetDays,
+				OnsetIssue:      onsetIssue,
+				CoAdministered:  summary.CoAdministered,
+				Country:         country,
+				State:           state,
+				Source:          src.FileName(),
+			}
+
+			batch.Reports = append(batch.Reports, r)
+			seen[vaersID] = true
+			return nil
+		})
+		if err != nil {
+			log.Printf("failed to read from reports csv file %s: %v", src.Name(), err)
 			return err
 		}
-		linesRead++
 
-		if linesRead > 1 {
+		i.countRows(src, rows)
+		log.Printf("finished reading reports file %s, read %d rows", src.Name(), rows)
+	}
+
+	return nil
+}
+
+// Parse symptoms files, stage rows for the symptoms table, lookup categories for symptom and populate Symptoms in summary map
+func (i *CSVImporter) ReadSymptomsFile(ctx context.Context, vaccineMap map[int64]bool, summaryMap map[int64]*Summary, batch *store.ImportBatch) (map[string]int, error) {
+	symptomsMap := map[string]int{}
+	staged := map[string]store.Symptom{}
+	categoryIDs := map[string]int{}
+
+	for _, src := range i.SymptomsFiles {
+		rows, err := readCSV(src, func(line []string) error {
 			vaersID, err := strconv.ParseInt(line[0], 10, 64)
 			if err != nil {
-				log.Printf("failed to convert vaers_id %q to int64, skipping row: %v", line[0], err)
-				continue
+				return err
 			}
 
-			// Add to DB only if covid19 row
-			if _, ok := summaryMap[vaersID]; ok {
-				var age float64
-				if line[3] != "" {
-					age, err = strconv.ParseFloat(line[3], 0)
-					if err != nil {
-						log.Printf("failed to convert age %q to int64, skipping row: %v", line[3], err)
-						continue
-					}
+			symptoms := []string{line[1], line[3], line[5], line[7], line[9]}
+
+			if _, ok := vaccineMap[vaersID]; ok {
+				symptomsToAdd := symptoms
+				loadSymptoms(symptomsMap, symptomsToAdd)
+			}
+
+			for _, s := range symptoms {
+				if s == "" {
+					continue
 				}
 
-				reportedAt, err := time.Parse("01/02/2006", line[1])
-				if err != nil {
-					log.Printf("failed to convert reportedAt %q to time format, skipping row: %v", line[1], err)
+				s = strings.ToLower(s)
+				categories, ok := data.CategoriesMap[s]
+				if !ok {
+					i.skip("uncategorized symptom", "")
 					continue
 				}
 
-				r := store.Report{
-					VaersID:    vaersID,
-					Age:        int(age),
-					Sex:        store.SexFromString(line[6]),
-					Notes:      line[8],
-					ReportedAt: reportedAt,
+				symptom, ok := staged[s]
+				if !ok {
+					symptom = store.Symptom{Name: s, Slug: store.SymptomSlug(s)}
+					if a, ok := data.AliasesMap[s]; ok {
+						symptom.Alias = a
+					}
+
+					for _, c := range categories {
+						cID, ok := categoryIDs[c]
+						if !ok {
+							cID, err = i.DBClient.GetCategoryID(ctx, c)
+							if err != nil {
+								i.skip("unknown category", "failed to fetch category ID for category %s: %v", c, err)
+								continue
+							}
+							categoryIDs[c] = cID
+						}
+						symptom.CategoryIDs = append(symptom.CategoryIDs, cID)
+					}
+					staged[s] = symptom
 				}
 
-				if err = i.DBClient.InsertReport(ctx, r); err != nil {
-					log.Printf("failed to insert report for vaers_id %v: %v", r.VaersID, err)
+				if _, ok := summaryMap[vaersID]; !ok {
 					continue
 				}
+
+				summaryMap[vaersID].Symptoms = append(summaryMap[vaersID].Symptoms, symptom)
 			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("failed to read from symptoms csv file %s: %v", src.Name(), err)
+			return nil, err
 		}
+
+		i.countRows(src, rows)
+		log.Printf("finished reading symptoms file %s, read %d rows", src.Name(), rows)
 	}
 
-	log.Printf("finished reading reports file, read %d lines", linesRead)
-	return nil
+	for _, symptom := range staged {
+		batch.Symptoms = append(batch.Symptoms, symptom)
+	}
+
+	return symptomsMap, nil
 }
 
-// Parse symptoms file, insert into symptoms table, lookup categories for symptom and populate Symptoms in summary map
-func (i *CSVImporter) ReadSymptomsFile(ctx context.Context, vaccineMap map[int64]bool, summaryMap map[int64]*Summary) (map[string]int, error) {
-	csvFile, err := os.Open(i.SymptomsFilePath)
+// Read every row of a csv source after the header, returning the number of rows read
+func readCSV(src Source, readLine func(line []string) error) (int, error) {
+	rc, err := src.Open()
 	if err != nil {
-		log.Printf("failed to open symptoms csv file: %v", err)
-		return nil, err
+		return 0, err
 	}
+	defer rc.Close()
 
-	reader := csv.NewReader(bufio.NewReader(csvFile))
+	reader := csv.NewReader(bufio.NewReader(rc))
 	linesRead := 0
-	symptomsMap := map[string]int{}
 
 	for {
 		line, err := reader.Read()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Printf("failed to read from symptoms csv file: %v", err)
-			return nil, err
+			return linesRead - 1, err
 		}
 		linesRead++
 
 		if linesRead > 1 {
-			id, err := strconv.ParseInt(line[0], 10, 64)
-			if err != nil {
-				return nil, err
+			if err := readLine(line); err != nil {
+				return linesRead - 1, err
 			}
+		}
+	}
 
-			symptoms := []string{line[1], line[3], line[5], line[7], line[9]}
+	if linesRead == 0 {
+		return 0, nil
+	}
+	return linesRead - 1, nil
+}
 
-			if _, ok := vaccineMap[id]; ok {
-				symptomsToAdd := symptoms
-				loadSymptoms(symptomsMap, symptomsToAdd)
+// Write a csv file listing each changed report, for publishing alongside a data refresh
+func writeChangelog(path string, changes store.ImportChanges) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"change", "vaers_id"}); err != nil {
+		return err
+	}
+
+	for _, c := range []struct {
+		change   string
+		vaersIDs []int64
+	}{
+		{store.ReportAdded, changes.Added},
+		{store.ReportUpdated, changes.Updated},
+		{store.ReportRemoved, changes.Removed},
+	} {
+		for _, id := range c.vaersIDs {
+			if err := w.Write([]string{c.change, strconv.FormatInt(id, 10)}); err != nil {
+				return err
 			}
+		}
+	}
 
-			for _, s := range symptoms {
-				if s != "" {
-					s = strings.ToLower(s)
-					categories, ok := data.CategoriesMap[s]
-					if !ok {
-						//log.Printf("symptom %s not found in categories map, skipping", s)
-						continue
-					}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
 
-					symptom := store.Symptom{Name: s}
-					if a, ok := data.AliasesMap[s]; ok {
-						symptom.Alias = a
-					}
+	log.Printf("wrote changelog to %s", path)
+	return nil
+}
 
-					sID, err := i.DBClient.InsertSymptom(ctx, symptom)
-					if err != nil {
-						log.Printf("failed to insert symptom %s for vaers_id %s, skipping row %v", s, line[0], err)
-						continue
-					}
-					symptom.ID = sID
+// Record the checksum of a source file against the import run, archives are only checksummed once
+func (i CSVImporter) addFile(src Source, checksums map[string]string) error {
+	sum, ok := checksums[src.Path]
+	if !ok {
+		var err error
+		sum, err = src.Checksum()
+		if err != nil {
+			return err
+		}
+		checksums[src.Path] = sum
+	}
 
-					vaersID, err := strconv.ParseInt(line[0], 10, 64)
-					if err != nil {
-						log.Printf("failed to convert vaers_id %q to int64, skipping row: %v", line[0], err)
-						continue
-					}
+	i.run.Files = append(i.run.Files, store.ImportFile{
+		Name:   src.Name(),
+		SHA256: sum,
+	})
+	return nil
+}
 
-					if _, ok := summaryMap[vaersID]; !ok {
-						//log.Printf("failed to fetch summary for vaers_id %v, skipping row", vaersID)
-						continue
-					}
+// Record the number of data rows read from a source file against the import run
+func (i CSVImporter) countRows(src Source, rows int) {
+	if i.run == nil {
+		return
+	}
+	for n, f := range i.run.Files {
+		if f.Name == src.Name() {
+			i.run.Files[n].Rows = rows
+		}
+	}
+}
 
-					var categoryIDs []int
-					for _, c := range categories {
-						cID, err := i.DBClient.GetCategoryID(ctx, c)
-						if err != nil {
-							log.Printf("failed to fetch category ID for category %s: %v", c, err)
-						}
-						categoryIDs = append(categoryIDs, cID)
-					}
+// Log why a row was skipped, if there's anything to add, and count it against the import run
+func (i CSVImporter) skip(reason string, format string, v ...interface{}) {
+	if format != "" {
+		log.Printf(format, v...)
+	}
+	if i.run != nil {
+		i.run.Skipped[reason]++
+	}
+}
 
-					symptom.CategoryIDs = categoryIDs
-					summaryMap[vaersID].Symptoms = append(summaryMap[vaersID].Symptoms, symptom)
-				}
-			}
+// Count a row that's kept with a field left out against the import run, apart from the skipped rows
+func (i CSVImporter) flag(reason string) {
+	if i.run != nil {
+		i.run.Flagged[reason]++
+	}
+}
+
+// VAERS began collecting reports in July 1990, earlier vaccination dates are typos
+var vaersStart = time.Date(1990, time.July, 1, 0, 0, 0, 0, time.UTC)
+
+// Dates are blank when the reporter didn't know them
+func parseDate(s string) *time.Time {
+	t, err := time.Parse("01/02/2006", s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// Compute the days from vaccination to onset, from the dates when both are known or NUMDAYS otherwise,
+// and flag dates that contradict each other or the date the report was received
+func onset(vaccinatedAt, onsetAt *time.Time, numDays string, reportedAt time.Time) (*int, store.OnsetIssue) {
+	switch {
+	case vaccinatedAt != nil && vaccinatedAt.Before(vaersStart):
+		return nil, store.VaccinationBeforeVAERS
+	case vaccinatedAt != nil && vaccinatedAt.After(reportedAt):
+		return nil, store.VaccinationAfterReport
+	case onsetAt != nil && onsetAt.After(reportedAt):
+		return nil, store.OnsetAfterReport
+	}
+
+	days, err := strconv.Atoi(numDays)
+	hasNumDays := err == nil
+
+	if vaccinatedAt != nil && onsetAt != nil {
+		gap := int(onsetAt.Sub(*vaccinatedAt).Hours() / 24)
+		if gap < 0 {
+			return nil, store.OnsetBeforeVaccination
+		}
+		if hasNumDays && days != gap {
+			return nil, store.NumDaysMismatch
 		}
+		return &gap, store.NoOnsetIssue
 	}
 
-	log.Printf("finished reading symptoms file, read %d lines \n", linesRead)
-	return symptomsMap, nil
+	if !hasNumDays {
+		return nil, store.NoOnsetIssue
+	}
+	if days < 0 {
+		return nil, store.OnsetBeforeVaccination
+	}
+	return &days, store.NoOnsetIssue
+}
+
+// RECOVD is Y or N, U or blank when the recovery is unknown
+func recovered(s string) *bool {
+	var r bool
+	switch s {
+	case "Y":
+		r = true
+	case "N":
+		r = false
+	default:
+		return nil
+	}
+	return &r
 }
 
 func loadSymptoms(symptomsMap map[string]int, symptomsToAdd []string) map[string]int {
@@ -443,3 +892,35 @@ func containsKeyWord(s string, keywords []string) bool {
 	}
 	return false
 }
+
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// illnessOf returns the slug of the illness a VAX_TYPE is against, empty for illnesses we don't track
+func illnessOf(illnesses []store.Illness, vaxType string) string {
+	for _, illness := range illnesses {
+		if illness.MatchesVAERS(vaxType) {
+			return illness.Slug
+		}
+	}
+	return ""
+}
+
+// countryFromSplitType returns the country code prefixed to the manufacturer report number of a non domestic
+// report, e.g. GB in GBPFIZER INC2021123456, empty when there's no known prefix
+func countryFromSplitType(splitType string) string {
+	splitType = strings.ToUpper(strings.TrimSpace(splitType))
+	if len(splitType) < 2 {
+		return ""
+	}
+	if _, ok := data.Countries[splitType[:2]]; !ok {
+		return ""
+	}
+	return splitType[:2]
+}
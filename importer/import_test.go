@@ -0,0 +1,302 @@
+package importer
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thehungrysmurf/vax/db/store"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// testVaersIDs are the reports in test_data, the first five go into the 2021 archive and the others into 2022's
+var testVaersIDs = []string{"0916600", "0916601", "0916602", "0916603", "0916604", "0916606", "0916607", "0916608", "0916610", "0916611"}
+
+// testDB connects to the database in DB_URI, with its tables created by db/scripts/recreate_tables.sh, and empties
+// its report tables. The tests importing into it are skipped without one.
+func testDB(tb testing.TB) *store.DB {
+	tb.Helper()
+	uri := os.Getenv("DB_URI")
+	if uri == "" {
+		tb.Skip("DB_URI isn't set")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, uri)
+	if err != nil {
+		tb.Fatalf("failed to connect to database: %v", err)
+	}
+	tb.Cleanup(func() { conn.Close(ctx) })
+
+	if _, err := conn.Exec(ctx, store.TruncateReportTablesQuery); err != nil {
+		tb.Fatalf("failed to empty the report tables: %v", err)
+	}
+	return store.NewDB(conn)
+}
+
+// writeArchive zips the rows of the test_data files for the VAERS IDs into an archive named like VAERS names the
+// year's, e.g. 2021VAERSData.zip holding 2021VAERSDATA.csv
+func writeArchive(tb testing.TB, dir, year string, vaersIDs []string) string {
+	tb.Helper()
+	path := filepath.Join(dir, year+"VAERSData.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for file, member := range map[string]string{"reports.csv": "VAERSDATA.csv", "vaccines.csv": "VAERSVAX.csv", "symptoms.csv": "VAERSSYMPTOMS.csv"} {
+		b, err := ioutil.ReadFile(filepath.Join("..", "test_data", file))
+		if err != nil {
+			tb.Fatalf("failed to read %s: %v", file, err)
+		}
+
+		// The test files have a row per line, the header is kept
+		lines := strings.SplitAfter(string(b), "\n")
+		rows := []string{lines[0]}
+		for _, line := range lines[1:] {
+			for _, id := range vaersIDs {
+				if strings.HasPrefix(line, id+",") {
+					rows = append(rows, line)
+				}
+			}
+		}
+
+		w, err := zw.Create(year + member)
+		if err != nil {
+			tb.Fatalf("failed to add %s to archive: %v", member, err)
+		}
+		if _, err := w.Write([]byte(strings.Join(rows, ""))); err != nil {
+			tb.Fatalf("failed to write %s: %v", member, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		tb.Fatalf("failed to write archive: %v", err)
+	}
+	return path
+}
+
+// writeVaccinationTotals writes a vaccination totals file without any doses
+func writeVaccinationTotals(tb testing.TB, dir string) string {
+	tb.Helper()
+	path := filepath.Join(dir, "vaccinations.csv")
+	if err := ioutil.WriteFile(path, []byte("location,date,vaccine,total_vaccinations\n"), 0644); err != nil {
+		tb.Fatalf("failed to write vaccination totals: %v", err)
+	}
+	return path
+}
+
+// mergeArchives imports the archives incrementally, like a weekly release
+func mergeArchives(tb testing.TB, dbClient *store.DB, totals string, archives ...string) {
+	tb.Helper()
+	i, err := NewArchiveImporter(totals, archives, dbClient)
+	if err != nil {
+		tb.Fatalf("failed to find archives: %v", err)
+	}
+	i.Incremental = true
+	if err := i.Run(); err != nil {
+		tb.Fatalf("failed to merge %s: %v", strings.Join(archives, ", "), err)
+	}
+}
+
+// imported lists which of the VAERS IDs have a report in the database
+func imported(tb testing.TB, dbClient *store.DB, vaersIDs []string) map[string]bool {
+	tb.Helper()
+	found := map[string]bool{}
+	for _, id := range vaersIDs {
+		vaersID, _ := strconv.ParseInt(id, 10, 64)
+		_, err := dbClient.GetReport(context.Background(), vaersID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		} else if err != nil {
+			tb.Fatalf("failed to get report %s: %v", id, err)
+		}
+		found[id] = true
+	}
+	return found
+}
+
+// Merging one year's archive after another's keeps the other year's reports, only the reports missing from the
+// archive's own file are removed
+func TestMergeArchivesInTurn(t *testing.T) {
+	dbClient := testDB(t)
+	dir := t.TempDir()
+	totals := writeVaccinationTotals(t, dir)
+	ids2021, ids2022 := testVaersIDs[:5], testVaersIDs[5:]
+
+	mergeArchives(t, dbClient, totals, writeArchive(t, dir, "2021", ids2021))
+	mergeArchives(t, dbClient, totals, writeArchive(t, dir, "2022", ids2022))
+	found := imported(t, dbClient, testVaersIDs)
+	for _, id := range testVaersIDs {
+		if !found[id] {
+			t.Errorf("report %s is missing after importing both archives", id)
+		}
+	}
+
+	// The next 2021 release withdraws a report
+	mergeArchives(t, dbClient, totals, writeArchive(t, dir, "2021", ids2021[1:]))
+	found = imported(t, dbClient, testVaersIDs)
+	if found[ids2021[0]] {
+		t.Errorf("withdrawn report %s wasn't removed", ids2021[0])
+	}
+	for _, id := range testVaersIDs[1:] {
+		if !found[id] {
+			t.Errorf("report %s was removed along with the withdrawn one", id)
+		}
+	}
+}
+
+// The reports of an archive are known by their file's name, the same in every release of the year
+func TestArchiveFileNames(t *testing.T) {
+	path := writeArchive(t, t.TempDir(), "2021", testVaersIDs[:2])
+	reports, _, _, err := DiscoverArchives([]string{path})
+	if err != nil {
+		t.Fatalf("failed to find archives: %v", err)
+	}
+	if len(reports) != 1 || reports[0].FileName() != "2021VAERSDATA.CSV" {
+		t.Fatalf("got reports files %v, want 2021VAERSDATA.CSV", reports)
+	}
+
+	rows, err := readCSV(reports[0], func(line []string) error { return nil })
+	if err != nil {
+		t.Fatalf("failed to read reports: %v", err)
+	}
+	if rows != 2 {
+		t.Errorf("got %d reports, want 2", rows)
+	}
+
+	if name := FileSource(filepath.Join("data", "NonDomesticVAERSDATA.csv"), true).FileName(); name != "NONDOMESTICVAERSDATA.CSV" {
+		t.Errorf("got file name %s, want NONDOMESTICVAERSDATA.CSV", name)
+	}
+}
+
+// The comparison of one sex's reports counts no more of them than the comparison of every sex's
+func TestComparisonBySex(t *testing.T) {
+	dbClient := testDB(t)
+	testData := filepath.Join("..", "test_data")
+	i := NewCSVImporter(writeVaccinationTotals(t, t.TempDir()), filepath.Join(testData, "reports.csv"),
+		filepath.Join(testData, "vaccines.csv"), filepath.Join(testData, "symptoms.csv"), dbClient)
+	if err := i.Run(); err != nil {
+		t.Fatalf("failed to import test_data: %v", err)
+	}
+
+	ctx := context.Background()
+	categories, err := dbClient.GetCategories(ctx)
+	if err != nil {
+		t.Fatalf("failed to get categories: %v", err)
+	}
+	for _, c := range categories {
+		all, err := dbClient.GetComparison(ctx, store.Covid19, c.Slug, store.UnknownSex, 0, 0, store.Filter{})
+		if err != nil {
+			t.Fatalf("failed to compare %s reports: %v", c.Slug, err)
+		}
+		for _, sex := range []store.Sex{store.Female, store.Male} {
+			bySex, err := dbClient.GetComparison(ctx, store.Covid19, c.Slug, sex, 0, 0, store.Filter{})
+			if err != nil {
+				t.Fatalf("failed to compare %s reports of sex %s: %v", c.Slug, sex, err)
+			}
+			for n, vc := range bySex {
+				if vc.Count > all[n].Count {
+					t.Errorf("%s %s: got %d reports of sex %s, more than the %d of every sex", vc.Vaccine.Slug, c.Slug, vc.Count, sex, all[n].Count)
+				}
+			}
+		}
+	}
+}
+
+// The doses are replaced in the import's transaction, an import failing after reading them keeps the ones before
+func TestFailedImportKeepsDoses(t *testing.T) {
+	dbClient := testDB(t)
+	dir := t.TempDir()
+	testData := filepath.Join("..", "test_data")
+	totals := filepath.Join(dir, "vaccinations.csv")
+	writeTotals := func(total string) {
+		t.Helper()
+		row := "United States,2021-01-01,Moderna," + total + "\n"
+		if err := ioutil.WriteFile(totals, []byte("location,date,vaccine,total_vaccinations\n"+row), 0644); err != nil {
+			t.Fatalf("failed to write vaccination totals: %v", err)
+		}
+	}
+
+	writeTotals("1000")
+	i := NewCSVImporter(totals, filepath.Join(testData, "reports.csv"), filepath.Join(testData, "vaccines.csv"),
+		filepath.Join(testData, "symptoms.csv"), dbClient)
+	if err := i.Run(); err != nil {
+		t.Fatalf("failed to import test_data: %v", err)
+	}
+
+	// The reports file has a row missing its fields
+	writeTotals("2000")
+	reports := filepath.Join(dir, "reports.csv")
+	if err := ioutil.WriteFile(reports, []byte("VAERS_ID,RECVDATE\nx\n"), 0644); err != nil {
+		t.Fatalf("failed to write reports: %v", err)
+	}
+	i = NewCSVImporter(totals, reports, filepath.Join(testData, "vaccines.csv"), filepath.Join(testData, "symptoms.csv"), dbClient)
+	if err := i.Run(); err == nil {
+		t.Fatal("imported a malformed reports file")
+	}
+
+	vt, err := dbClient.GetVaccinationTotals(context.Background(), "US")
+	if err != nil {
+		t.Fatalf("failed to get vaccination totals: %v", err)
+	}
+	var total int64
+	for _, n := range vt {
+		total += n
+	}
+	if total != 1000 {
+		t.Errorf("got %d doses after the failed import, want the 1000 from before it", total)
+	}
+}
+
+// The summary of an import lists the reasons in order, the same on every run
+func TestPrintCounts(t *testing.T) {
+	var b strings.Builder
+	printCounts(&b, "Skipped", map[string]int{"unknown vaccine": 2, "invalid age": 1, "missing report": 3})
+	want := "Skipped:\n" +
+		"invalid age                        1\n" +
+		"missing report                     3\n" +
+		"unknown vaccine                    2\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	printCounts(&b, "Flagged", nil)
+	if b.Len() != 0 {
+		t.Errorf("printed %q without any counts", b.String())
+	}
+}
+
+// BenchmarkImport reads the test_data files and loads them through the staging tables, copying the batch in and
+// swapping it into the report tables, or merging it into them for an incremental import
+func BenchmarkImport(b *testing.B) {
+	dbClient := testDB(b)
+	totals := writeVaccinationTotals(b, b.TempDir())
+	testData := filepath.Join("..", "test_data")
+
+	for _, incremental := range []bool{false, true} {
+		name := "swap"
+		if incremental {
+			name = "merge"
+		}
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				i := NewCSVImporter(totals, filepath.Join(testData, "reports.csv"), filepath.Join(testData, "vaccines.csv"),
+					filepath.Join(testData, "symptoms.csv"), dbClient)
+				i.Incremental = incremental
+				if err := i.Run(); err != nil {
+					b.Fatalf("failed to import test_data: %v", err)
+				}
+			}
+		})
+	}
+}
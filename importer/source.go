@@ -0,0 +1,196 @@
+package importer
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Suffixes of the csv files inside a VAERS archive, e.g. 2021VAERSDATA.csv in 2021VAERSData.zip
+const (
+	ReportsFileSuffix  = "VAERSDATA.CSV"
+	VaccinesFileSuffix = "VAERSVAX.CSV"
+	SymptomsFileSuffix = "VAERSSYMPTOMS.CSV"
+	// Prefix of the files of reports from outside the US, e.g. NonDomesticVAERSDATA.csv
+	NonDomesticFilePrefix = "NONDOMESTIC"
+)
+
+// Source is a csv file to import, either on disk or inside a zip archive
+type Source struct {
+	// Path is the file on disk, or the zip archive holding the file if Member is set
+	Path string
+	// Member is the name of the file inside the zip archive
+	Member string
+	// Latin1 is set for VAERS files, which aren't UTF-8 encoded
+	Latin1 bool
+	// NonDomestic is set for the VAERS files of reports from outside the US
+	NonDomestic bool
+}
+
+// FileSource is a csv file on disk, of reports from outside the US when it's named like NonDomesticVAERSDATA.csv
+func FileSource(path string, latin1 bool) Source {
+	name := strings.ToUpper(filepath.Base(path))
+	return Source{Path: path, Latin1: latin1, NonDomestic: strings.HasPrefix(name, NonDomesticFilePrefix)}
+}
+
+// Name identifies the source in logs and import runs
+func (s Source) Name() string {
+	if s.Member != "" {
+		return filepath.Base(s.Path) + "/" + s.Member
+	}
+	return filepath.Base(s.Path)
+}
+
+// FileName is the upper case name of the csv file, the same in every release, e.g. 2021VAERSDATA.CSV
+func (s Source) FileName() string {
+	if s.Member != "" {
+		return strings.ToUpper(filepath.Base(s.Member))
+	}
+	return strings.ToUpper(filepath.Base(s.Path))
+}
+
+// Open streams the source's content as UTF-8, decompressing archive members without extracting them to disk
+func (s Source) Open() (io.ReadCloser, error) {
+	var rc io.ReadCloser
+
+	if s.Member == "" {
+		f, err := os.Open(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+	} else {
+		archive, err := zip.OpenReader(s.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var member *zip.File
+		for _, f := range archive.File {
+			if f.Name == s.Member {
+				member = f
+				break
+			}
+		}
+		if member == nil {
+			archive.Close()
+			return nil, fmt.Errorf("%s not found in archive %s", s.Member, s.Path)
+		}
+
+		m, err := member.Open()
+		if err != nil {
+			archive.Close()
+			return nil, err
+		}
+		rc = archiveMember{ReadCloser: m, archive: archive}
+	}
+
+	if !s.Latin1 {
+		return rc, nil
+	}
+
+	// VAERS exports Latin-1 text, in practice the Windows-1252 superset, which also covers the curly quotes in narratives
+	return readCloser{Reader: transform.NewReader(rc, charmap.Windows1252.NewDecoder()), Closer: rc}, nil
+}
+
+// Checksum is the sha256 of the file on disk, the whole archive for archive members
+func (s Source) Checksum() (string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DiscoverArchives finds the reports, vaccines and symptoms files in VAERS zip archives, given the archives
+// themselves or directories holding them
+func DiscoverArchives(paths []string) (reports, vaccines, symptoms []Source, err error) {
+	var archives []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if !info.IsDir() {
+			archives = append(archives, p)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".zip") {
+				archives = append(archives, filepath.Join(p, e.Name()))
+			}
+		}
+	}
+	sort.Strings(archives)
+
+	for _, a := range archives {
+		r, err := zip.OpenReader(a)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open archive %s: %v", a, err)
+		}
+
+		found := map[string]Source{}
+		for _, f := range r.File {
+			name := strings.ToUpper(filepath.Base(f.Name))
+			for _, suffix := range []string{ReportsFileSuffix, VaccinesFileSuffix, SymptomsFileSuffix} {
+				if strings.HasSuffix(name, suffix) {
+					found[suffix] = Source{Path: a, Member: f.Name, Latin1: true, NonDomestic: strings.HasPrefix(name, NonDomesticFilePrefix)}
+				}
+			}
+		}
+		r.Close()
+
+		if len(found) != 3 {
+			return nil, nil, nil, fmt.Errorf("archive %s must hold a DATA, VAX and SYMPTOMS csv file, found %d", a, len(found))
+		}
+
+		reports = append(reports, found[ReportsFileSuffix])
+		vaccines = append(vaccines, found[VaccinesFileSuffix])
+		symptoms = append(symptoms, found[SymptomsFileSuffix])
+	}
+
+	if len(archives) == 0 {
+		return nil, nil, nil, fmt.Errorf("no zip archives found in %s", strings.Join(paths, ", "))
+	}
+
+	return reports, vaccines, symptoms, nil
+}
+
+// archiveMember closes the archive along with the member being read
+type archiveMember struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (m archiveMember) Close() error {
+	m.ReadCloser.Close()
+	return m.archive.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
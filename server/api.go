@@ -0,0 +1,385 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/thehungrysmurf/vax/api"
+	"github.com/thehungrysmurf/vax/db/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v4"
+)
+
+// apiPrefix is the path of the JSON API, the version changes when a response changes incompatibly
+const apiPrefix = "/api/v1"
+
+// apiRoutes serves the JSON API, the data of the HTML pages with the same query string filters. Errors answer with
+// their status code and an apiError.
+func apiRoutes(dbClient store.Store) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(api.OpenAPIv1)
+		})
+
+		r.Get("/vaccines", func(w http.ResponseWriter, r *http.Request) {
+			vaccines, err := dbClient.GetVaccines(r.Context())
+			if err != nil {
+				writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get vaccines: %v", err))
+				return
+			}
+
+			ret := []apiVaccine{}
+			for _, v := range vaccines {
+				ret = append(ret, newAPIVaccine(v))
+			}
+			writeJSON(w, r, ret)
+		})
+
+		// Latest cumulative doses administered by vaccine, in the US unless location is another country's ISO code
+		r.Get("/vaccination-totals", func(w http.ResponseWriter, r *http.Request) {
+			location := string(store.UnitedStates)
+			if l := r.URL.Query().Get("location"); l != "" {
+				location = store.RegionFromString(l).Country()
+				if location == "" {
+					writeAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unknown country %q", l))
+					return
+				}
+			}
+
+			vaccines, err := dbClient.GetVaccines(r.Context())
+			if err != nil {
+				writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get vaccines: %v", err))
+				return
+			}
+
+			totals, err := dbClient.GetVaccinationTotals(r.Context(), location)
+			if err != nil {
+				writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get vaccination totals: %v", err))
+				return
+			}
+
+			ret := apiVaccinationTotals{Location: location, Totals: []apiVaccinationTotal{}}
+			for _, v := range vaccines {
+				if total, ok := totals[v.ID]; ok {
+					ret.Totals = append(ret.Totals, apiVaccinationTotal{Vaccine: newAPIVaccine(v), Doses: total})
+				}
+			}
+			writeJSON(w, r, ret)
+		})
+
+		r.Route("/vaccines/{vaccine}", func(r chi.Router) {
+			r.Get("/categories", func(w http.ResponseWriter, r *http.Request) {
+				vaccine, filter, doses, ok := apiVaccineFilter(w, r, dbClient)
+				if !ok {
+					return
+				}
+
+				counts, err := dbClient.GetCategoryCounts(r.Context(), vaccine.Slug, filter, doses)
+				if err != nil {
+					writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get category counts: %v", err))
+					return
+				}
+
+				ret := apiCategoryCounts{apiCounts: newAPICounts(vaccine, filter, doses), Categories: []apiCategoryCount{}}
+				for _, cc := range counts {
+					c := apiCategoryCount{Category: cc.Category, Slug: cc.CategorySlug, Count: cc.Count, Rate: apiRate(cc.Rate, doses), AgeSex: []apiAgeSexCount{}}
+					for _, as := range cc.AgeSex {
+						c.AgeSex = append(c.AgeSex, apiAgeSexCount{
+							Sex:    strings.ToLower(as.Sex.String()),
+							AgeMin: as.AgeGroup.Min,
+							AgeMax: as.AgeGroup.Max,
+							Count:  as.Count,
+							Rate:   apiRate(as.Rate, as.Doses),
+						})
+					}
+					ret.Categories = append(ret.Categories, c)
+				}
+				writeJSON(w, r, ret)
+			})
+
+			r.Get("/symptoms", func(w http.ResponseWriter, r *http.Request) {
+				vaccine, filter, doses, ok := apiVaccineFilter(w, r, dbClient)
+				if !ok {
+					return
+				}
+
+				counts, err := dbClient.GetSymptomCounts(r.Context(), vaccine.Slug, filter, doses)
+				if err != nil {
+					writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get symptom counts: %v", err))
+					return
+				}
+				writeJSON(w, r, newAPISymptomCounts(vaccine, filter, doses, counts))
+			})
+
+			r.Get("/life-threatening-symptoms", func(w http.ResponseWriter, r *http.Request) {
+				vaccine, filter, doses, ok := apiVaccineFilter(w, r, dbClient)
+				if !ok {
+					return
+				}
+
+				counts, err := dbClient.GetLifeThreateningSymptomCounts(r.Context(), vaccine.Slug, filter, doses)
+				if err != nil {
+					writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get life threatening symptom counts: %v", err))
+					return
+				}
+				writeJSON(w, r, newAPISymptomCounts(vaccine, filter, doses, counts))
+			})
+
+			// Reports selected like on the reports page, e.g. ?sex=female&age=18-64&category=flu-like&sort=age
+			r.Get("/reports", func(w http.ResponseWriter, r *http.Request) {
+				vaccine, filter, _, ok := apiVaccineFilter(w, r, dbClient)
+				if !ok {
+					return
+				}
+
+				categories, err := dbClient.GetCategories(r.Context())
+				if err != nil {
+					writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get categories: %v", err))
+					return
+				}
+
+				rf, params, err := reportFilterFromQuery(r, categories)
+				if err != nil {
+					writeAPIError(w, r, http.StatusBadRequest, err)
+					return
+				}
+				page, err := reportPageFromQuery(r)
+				if err != nil {
+					writeAPIError(w, r, http.StatusBadRequest, err)
+					return
+				}
+
+				results, err := dbClient.GetFilteredResults(r.Context(), vaccine.Slug, rf, page, filter)
+				if err != nil {
+					writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get reports: %v", err))
+					return
+				}
+
+				// The links to the pages around keep every parameter of this one but its cursor
+				params = pageParams(params, page)
+				for k, v := range map[string]string{"outcome": string(rf.Outcome), "coadmin": string(filter.CoAdmin), "region": string(filter.Region)} {
+					if v != "" {
+						params.Set(k, v)
+					}
+				}
+				link := func(key string, c *store.ReportCursor) string {
+					if c == nil {
+						return ""
+					}
+					values := url.Values{}
+					for k, v := range params {
+						values[k] = v
+					}
+					values.Set(key, c.String())
+					return fmt.Sprintf("%s/vaccines/%s/reports?%s", apiPrefix, vaccine.Slug, values.Encode())
+				}
+
+				ret := apiReports{
+					Vaccine: newAPIVaccine(vaccine),
+					Label:   rf.Label(),
+					Total:   results.Total,
+					Reports: []apiReport{},
+					Prev:    link("before", results.Prev),
+					Next:    link("after", results.Next),
+				}
+				for _, fr := range results.Results {
+					outcomes := []store.Outcome{}
+					ret.Reports = append(ret.Reports, apiReport{
+						VaersID:    fr.VaersID,
+						Age:        fr.Age,
+						ReportedAt: fr.ReportedAt,
+						Symptoms:   fr.Symptoms,
+						Outcomes:   append(outcomes, fr.Outcomes...),
+						Notes:      fr.Notes,
+						URL:        fmt.Sprintf("/report/%d/", fr.VaersID),
+					})
+				}
+				writeJSON(w, r, ret)
+			})
+		})
+
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, r, http.StatusNotFound, fmt.Errorf("no such endpoint %s", r.URL.Path))
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, r, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on %s", r.Method, r.URL.Path))
+		})
+	}
+}
+
+// apiVaccineFilter looks up the vaccine in the URL and reads the filter from the query string, with the doses to
+// compute rates with. It writes the error and returns false when either is invalid.
+func apiVaccineFilter(w http.ResponseWriter, r *http.Request, dbClient store.Store) (store.Vaccine, store.Filter, int64, bool) {
+	var filter store.Filter
+
+	vaccine, err := dbClient.GetVaccine(r.Context(), chi.URLParam(r, "vaccine"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeAPIError(w, r, http.StatusNotFound, fmt.Errorf("no such vaccine %q", chi.URLParam(r, "vaccine")))
+		return vaccine, filter, 0, false
+	} else if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get vaccine: %v", err))
+		return vaccine, filter, 0, false
+	}
+
+	q := r.URL.Query()
+	filter = filterFromQuery(r)
+	if c := q.Get("coadmin"); c != "" && string(filter.CoAdmin) != strings.ToLower(c) {
+		writeAPIError(w, r, http.StatusBadRequest, fmt.Errorf("coadmin must be only or exclude, not %q", c))
+		return vaccine, filter, 0, false
+	}
+	if reg := q.Get("region"); reg != "" && string(filter.Region) != strings.ToUpper(reg) {
+		writeAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unknown region %q", reg))
+		return vaccine, filter, 0, false
+	}
+
+	doses, err := dbClient.GetDoses(r.Context(), vaccine.Slug, filter)
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get doses: %v", err))
+		return vaccine, filter, 0, false
+	}
+	return vaccine, filter, doses, true
+}
+
+// apiRate is the rate per million doses, nil when there are no doses to go by
+func apiRate(rate float64, doses int64) *float64 {
+	if doses == 0 {
+		return nil
+	}
+	return &rate
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("failed to encode response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+type apiError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+	// RequestID is the ID server errors are logged with
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	ae := apiError{Status: status, Error: err.Error()}
+	if status == http.StatusInternalServerError {
+		ae.RequestID = requestIDOf(r)
+		log.Printf("request %s: %s %s: %v", ae.RequestID, r.Method, r.URL.Path, err)
+	}
+	b, _ := json.Marshal(ae)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+type apiVaccine struct {
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Illness string `json:"illness"`
+	// URL is the vaccine's HTML page
+	URL string `json:"url"`
+}
+
+func newAPIVaccine(v store.Vaccine) apiVaccine {
+	return apiVaccine{Slug: v.Slug, Name: v.Name, Illness: v.Illness, URL: v.Path() + "/"}
+}
+
+type apiVaccinationTotals struct {
+	Location string                `json:"location"`
+	Totals   []apiVaccinationTotal `json:"totals"`
+}
+
+type apiVaccinationTotal struct {
+	Vaccine apiVaccine `json:"vaccine"`
+	Doses   int64      `json:"doses"`
+}
+
+// apiCounts are the fields shared by the count responses
+type apiCounts struct {
+	Vaccine apiVaccine `json:"vaccine"`
+	CoAdmin string     `json:"coadmin"`
+	Region  string     `json:"region"`
+	// Doses are administered in the region's countries up to their latest reports, zero when rates can't be computed
+	Doses int64 `json:"doses"`
+}
+
+func newAPICounts(v store.Vaccine, filter store.Filter, doses int64) apiCounts {
+	return apiCounts{Vaccine: newAPIVaccine(v), CoAdmin: string(filter.CoAdmin), Region: string(filter.Region), Doses: doses}
+}
+
+type apiCategoryCounts struct {
+	apiCounts
+	Categories []apiCategoryCount `json:"categories"`
+}
+
+type apiCategoryCount struct {
+	Category string           `json:"category"`
+	Slug     string           `json:"slug"`
+	Count    int64            `json:"count"`
+	Rate     *float64         `json:"per_million_doses,omitempty"`
+	AgeSex   []apiAgeSexCount `json:"age_sex"`
+}
+
+// apiAgeSexCount has a rate where the doses administered to the sex and age group are on record
+type apiAgeSexCount struct {
+	Sex    string   `json:"sex"`
+	AgeMin int      `json:"age_min"`
+	AgeMax int      `json:"age_max"`
+	Count  int64    `json:"count"`
+	Rate   *float64 `json:"per_million_doses,omitempty"`
+}
+
+type apiSymptomCounts struct {
+	apiCounts
+	Symptoms []apiSymptomCount `json:"symptoms"`
+}
+
+type apiSymptomCount struct {
+	Symptom  string   `json:"symptom"`
+	Slug     string   `json:"slug"`
+	Category string   `json:"category"`
+	Count    int64    `json:"count"`
+	Rate     *float64 `json:"per_million_doses,omitempty"`
+}
+
+func newAPISymptomCounts(v store.Vaccine, filter store.Filter, doses int64, counts []store.SymptomCount) apiSymptomCounts {
+	ret := apiSymptomCounts{apiCounts: newAPICounts(v, filter, doses), Symptoms: []apiSymptomCount{}}
+	for _, sc := range counts {
+		ret.Symptoms = append(ret.Symptoms, apiSymptomCount{Symptom: sc.Symptom, Slug: sc.Slug, Category: sc.Category, Count: sc.Count, Rate: apiRate(sc.Rate, doses)})
+	}
+	return ret
+}
+
+type apiReports struct {
+	Vaccine apiVaccine `json:"vaccine"`
+	// Label describes the sexes and ages listed
+	Label   string      `json:"label"`
+	Total   int64       `json:"total"`
+	Reports []apiReport `json:"reports"`
+	// Prev and Next are the URLs of the pages around, empty on the first and the last page
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+type apiReport struct {
+	VaersID    int64           `json:"vaers_id"`
+	Age        *int            `json:"age"`
+	ReportedAt string          `json:"reported_at"`
+	Symptoms   []string        `json:"symptoms"`
+	Outcomes   []store.Outcome `json:"outcomes"`
+	Notes      string          `json:"notes"`
+	// URL is the report's HTML page
+	URL string `json:"url"`
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+func TestAPIReportsStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"found", "/api/v1/vaccines/pfizer/reports?outcome=died", http.StatusOK},
+		{"unknown vaccine", "/api/v1/vaccines/nope/reports", http.StatusNotFound},
+		{"unknown outcome", "/api/v1/vaccines/pfizer/reports?outcome=nope", http.StatusBadRequest},
+		{"inverted ages", "/api/v1/vaccines/pfizer/reports?age=64-18", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, fakeStore{}, tt.path)
+			if rec.Code != tt.status {
+				t.Errorf("GET %s: got status %d, want %d: %s", tt.path, rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	rec := serve(t, fakeStore{}, "/api/v1/openapi.json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode the OpenAPI document: %v", err)
+	}
+	if _, ok := doc["openapi"]; !ok {
+		t.Error("the OpenAPI document has no openapi version")
+	}
+}
+
+// rateStore has the doses of the region and of its women aged 16-25, not of its men
+type rateStore struct {
+	fakeStore
+}
+
+func (s rateStore) GetDoses(ctx context.Context, vaccineSlug string, filter store.Filter) (int64, error) {
+	return 4000000, nil
+}
+
+func (s rateStore) GetCategoryCounts(ctx context.Context, vaccineSlug string, filter store.Filter, doses int64) ([]store.CategoryCount, error) {
+	ag := store.AgeGroups[1]
+	return []store.CategoryCount{{Category: "Pain", CategorySlug: "pain", Count: 8, Rate: 2, AgeSex: []store.AgeSexCount{
+		{Sex: store.Female, AgeGroup: ag, Count: 3, Doses: 1000000, Rate: 3},
+		{Sex: store.Male, AgeGroup: ag, Count: 5},
+	}}}, nil
+}
+
+// The sexes and age groups have a rate where their own doses are on record
+func TestAPIAgeSexRates(t *testing.T) {
+	rec := serve(t, rateStore{}, "/api/v1/vaccines/pfizer/categories?region=US")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got apiCategoryCounts
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode the counts: %v", err)
+	}
+	if len(got.Categories) != 1 || len(got.Categories[0].AgeSex) != 2 {
+		t.Fatalf("got %+v, want a category with two sex and age groups", got.Categories)
+	}
+	female, male := got.Categories[0].AgeSex[0], got.Categories[0].AgeSex[1]
+	if female.Rate == nil || *female.Rate != 3 {
+		t.Errorf("got female rate %v, want 3", female.Rate)
+	}
+	if male.Rate != nil {
+		t.Errorf("got male rate %v, want none without doses", *male.Rate)
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+// lastImportRunTTL is how long the last import run is kept, it only changes when the importer runs
+const lastImportRunTTL = time.Minute
+
+// importRunCache keeps the last import run shown on every page, so rendering a page doesn't query it again
+type importRunCache struct {
+	store.Store
+
+	mu       sync.Mutex
+	run      store.ImportRun
+	loadedAt time.Time
+}
+
+func newImportRunCache(dbClient store.Store) *importRunCache {
+	return &importRunCache{Store: dbClient}
+}
+
+// GetLastImportRun returns the cached run while it's fresh, errors aren't cached
+func (c *importRunCache) GetLastImportRun(ctx context.Context) (store.ImportRun, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loadedAt.IsZero() && time.Since(c.loadedAt) < lastImportRunTTL {
+		return c.run, nil
+	}
+
+	run, err := c.Store.GetLastImportRun(ctx)
+	if err != nil {
+		return run, err
+	}
+	c.run, c.loadedAt = run, time.Now()
+	return run, nil
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+// countingStore counts the queries of the last import run
+type countingStore struct {
+	fakeStore
+	calls *int
+}
+
+func (s countingStore) GetLastImportRun(ctx context.Context) (store.ImportRun, error) {
+	*s.calls++
+	return store.ImportRun{ID: 1}, nil
+}
+
+func TestLastImportRunLoadedOnce(t *testing.T) {
+	calls := 0
+	router := NewRouter(countingStore{calls: &calls})
+	for _, path := range []string{"/about/", "/about/", "/nope/"} {
+		serveWith(t, router, path)
+	}
+	if calls != 1 {
+		t.Errorf("got %d queries of the last import run, want 1", calls)
+	}
+}
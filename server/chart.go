@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/message"
+
+	"github.com/thehungrysmurf/vax/chart"
+	"github.com/thehungrysmurf/vax/db/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Charts of a vaccine's page, served at e.g. /vaccine/pfizer/chart/symptoms.png
+const (
+	SymptomsChart                = "symptoms"
+	LifeThreateningSymptomsChart = "life-threatening-symptoms"
+)
+
+var (
+	charts       = []string{SymptomsChart, LifeThreateningSymptomsChart}
+	chartFormats = map[string]string{
+		"svg": "image/svg+xml",
+		"png": "image/png",
+	}
+)
+
+// ImagePaths lists the charts of every vaccine in each format, generated into the static site next to the pages
+func ImagePaths(ctx context.Context, dbClient store.Store) ([]string, error) {
+	vaccines, err := dbClient.GetVaccines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaccines: %v", err)
+	}
+
+	var paths []string
+	for _, v := range vaccines {
+		for _, c := range charts {
+			for _, format := range []string{"svg", "png"} {
+				paths = append(paths, fmt.Sprintf("%s/chart/%s.%s", v.Path(), c, format))
+			}
+		}
+	}
+	return paths, nil
+}
+
+// symptomsChart draws the bars of the vaccine page's symptom chart, rates is whether they're per million doses
+func symptomsChart(title string, counts []store.SymptomCount, rates bool) chart.BarChart {
+	p := message.NewPrinter(message.MatchLanguage("en"))
+	c := chart.BarChart{Title: title, Empty: "No symptoms reported"}
+	for _, sc := range counts {
+		b := chart.Bar{Label: sc.Symptom, Value: float64(sc.Count), ValueLabel: p.Sprint(sc.Count)}
+		if rates {
+			b.Value = sc.Rate
+			b.ValueLabel = p.Sprintf("%.1f", sc.Rate)
+		}
+		c.Bars = append(c.Bars, b)
+	}
+	return c
+}
+
+// vaccineChart serves a chart of the vaccine's symptoms as an image, filtered like the vaccine page by the query string
+func vaccineChart(w http.ResponseWriter, r *http.Request, dbClient store.Store, vaccine store.Vaccine) {
+	ctx := r.Context()
+	contentType, ok := chartFormats[chi.URLParam(r, "format")]
+	if !ok {
+		notFound(w, r, dbClient)
+		return
+	}
+
+	filter := filterFromQuery(r)
+	var (
+		counts []store.SymptomCount
+		title  string
+		doses  int64
+		err    error
+	)
+	// The rates are only charted when asked for, the counts don't need the doses
+	if perFromQuery(r) == PerMillion {
+		doses, err = dbClient.GetDoses(ctx, vaccine.Slug, filter)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get doses: %v", err))
+			return
+		}
+	}
+	switch chi.URLParam(r, "chart") {
+	case SymptomsChart:
+		title = vaccine.Name + ": most reported symptoms"
+		counts, err = dbClient.GetSymptomCounts(ctx, vaccine.Slug, filter, doses)
+	case LifeThreateningSymptomsChart:
+		title = vaccine.Name + ": life threatening symptoms"
+		counts, err = dbClient.GetLifeThreateningSymptomCounts(ctx, vaccine.Slug, filter, doses)
+	default:
+		notFound(w, r, dbClient)
+		return
+	}
+	if err != nil {
+		serverError(w, r, fmt.Errorf("failed to get symptom counts: %v", err))
+		return
+	}
+
+	rates := doses > 0
+	if rates {
+		title += " per million doses"
+	}
+
+	c := symptomsChart(title, counts, rates)
+	var buf bytes.Buffer
+	if contentType == "image/png" {
+		err = c.PNG(&buf)
+	} else {
+		err = c.SVG(&buf)
+	}
+	if err != nil {
+		serverError(w, r, fmt.Errorf("failed to draw chart: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	buf.WriteTo(w)
+}
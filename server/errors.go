@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	staticSiteKey
+)
+
+// requestID tags every request with an ID, sent back in the X-Request-ID header and logged with its server errors so
+// a reader reporting an error page can be matched to the log
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			log.Printf("failed to generate request ID: %v", err)
+		}
+		id := hex.EncodeToString(b)
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// requestIDOf is the ID given to the request, empty when it didn't go through the router
+func requestIDOf(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// paramError is a URL parameter that can't be served, Status is 404 when it names nothing and 400 when it's malformed
+type paramError struct {
+	Status int
+	Param  string
+	Value  string
+}
+
+func (e paramError) Error() string {
+	if e.Status == http.StatusNotFound {
+		return fmt.Sprintf("unknown %s %q", e.Param, e.Value)
+	}
+	return fmt.Sprintf("invalid %s %q", e.Param, e.Value)
+}
+
+// errorStatus is the status answering a request that failed with err, 500 unless it's a paramError
+func errorStatus(err error) int {
+	var pe paramError
+	if errors.As(err, &pe) {
+		return pe.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorPage explains why a request failed, RequestID is the ID a server error was logged with
+type ErrorPage struct {
+	Title     string
+	Status    int
+	Message   string
+	RequestID string
+}
+
+// paramFailed answers a request whose URL parameters failed to read, with the not found page or the error page
+func paramFailed(w http.ResponseWriter, r *http.Request, dbClient store.Store, err error) {
+	switch errorStatus(err) {
+	case http.StatusNotFound:
+		notFound(w, r, dbClient)
+	case http.StatusBadRequest:
+		badRequest(w, r, err)
+	default:
+		serverError(w, r, err)
+	}
+}
+
+// badRequest answers 400 with the error page, saying what's wrong with the URL
+func badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	errorPage(w, r, http.StatusBadRequest, err.Error())
+}
+
+// serverError logs err with the request's ID and answers 500 with the error page, which leaves out the error's details
+// but shows the ID, so a failed page is never served or generated as if it were whole
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("request %s: %s %s: %v", requestIDOf(r), r.Method, r.URL.Path, err)
+	errorPage(w, r, http.StatusInternalServerError, "Something went wrong on our side, please try again later.")
+}
+
+// errorPage renders the error page without the database, which may be why the request failed, answering in plain text
+// when even that fails
+func errorPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	ret := ErrorPage{Title: http.StatusText(status), Status: status, Message: message}
+	if status >= http.StatusInternalServerError {
+		ret.RequestID = requestIDOf(r)
+	}
+	buf, err := executeTemplate("templates/error.html", funcMap(store.ImportRun{}, "", "", isStatic(r)), ret)
+	if err != nil {
+		log.Printf("request %s: failed to render error page: %v", requestIDOf(r), err)
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+// Formats of the downloads
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+)
+
+// countDownloads are the downloads of the vaccine page's counts, the reports ones take the reports page's query
+var countDownloads = []string{"categories", "symptoms"}
+
+// DownloadPaths lists the count downloads of every vaccine in each format, generated into the static site next to the
+// pages
+func DownloadPaths(ctx context.Context, dbClient store.Store) ([]string, error) {
+	vaccines, err := dbClient.GetVaccines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaccines: %v", err)
+	}
+
+	var paths []string
+	for _, v := range vaccines {
+		for _, d := range countDownloads {
+			for _, format := range []string{exportCSV, exportJSON} {
+				paths = append(paths, fmt.Sprintf("%s/%s.%s", v.Path(), d, format))
+			}
+		}
+	}
+	return paths, nil
+}
+
+// exportSource is cited at the top of every download
+const exportSource = "VAERS, the Vaccine Adverse Event Reporting System, https://vaers.hhs.gov/data.html"
+
+// exportMeta is the header block of a download, what it lists and which data it comes from
+type exportMeta struct {
+	Title string
+	// Filters describe the rows selected, e.g. Region: United States
+	Filters []string
+	Run     store.ImportRun
+}
+
+// exporter writes a download row by row as they're read, so large ones aren't held in memory
+type exporter interface {
+	Row(values ...interface{}) error
+	// Close ends the download, it must be called once the rows are written
+	Close() error
+}
+
+// newExporter starts a download of the columns in the format, writing its headers and header block. It returns false
+// and answers 404 when the format isn't one of the downloads.
+func newExporter(w http.ResponseWriter, r *http.Request, format, filename string, meta exportMeta, columns []string) (exporter, bool) {
+	released, imported := "unknown", "unknown"
+	if meta.Run.VaersReleaseDate != nil {
+		released = meta.Run.VaersReleaseDate.Format("2006-01-02")
+	}
+	if meta.Run.FinishedAt != nil {
+		imported = meta.Run.FinishedAt.Format(time.RFC3339)
+	}
+
+	switch format {
+	case exportCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+
+		// The header block is comment lines, most CSV readers can be told to skip them
+		cw := csv.NewWriter(w)
+		lines := append([]string{meta.Title, "Source: " + exportSource, "VAERS release: " + released, "Imported: " + imported}, meta.Filters...)
+		for _, line := range lines {
+			if _, err := fmt.Fprintf(w, "# %s\n", strings.ReplaceAll(line, "\n", " ")); err != nil {
+				return nil, false
+			}
+		}
+		cw.Write(columns)
+		return &csvExporter{w: cw}, true
+
+	case exportJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+
+		bw := bufio.NewWriter(w)
+		filters := meta.Filters
+		if filters == nil {
+			filters = []string{}
+		}
+		head, _ := json.Marshal(map[string]interface{}{
+			"title":         meta.Title,
+			"source":        exportSource,
+			"vaers_release": released,
+			"imported":      imported,
+			"filters":       filters,
+		})
+		// The rows are added to the header object as they come
+		bw.Write(head[:len(head)-1])
+		bw.WriteString(`,"rows":[`)
+		return &jsonExporter{w: bw, columns: columns}, true
+	}
+
+	writeAPIError(w, r, http.StatusNotFound, fmt.Errorf("unknown download format %q, use csv or json", format))
+	return nil, false
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) Row(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = csvValue(v)
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvValue formats a value of a CSV cell, empty when it's unknown and lists separated by semicolons
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case *int:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.2f", *v)
+	case []string:
+		return strings.Join(v, "; ")
+	case []store.Outcome:
+		var outcomes []string
+		for _, o := range v {
+			outcomes = append(outcomes, string(o))
+		}
+		return strings.Join(outcomes, "; ")
+	}
+	return fmt.Sprint(v)
+}
+
+type jsonExporter struct {
+	w       *bufio.Writer
+	columns []string
+	rows    int
+}
+
+// Row writes the values as an object keyed by the columns, in their order
+func (e *jsonExporter) Row(values ...interface{}) error {
+	if e.rows > 0 {
+		e.w.WriteByte(',')
+	}
+	e.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.columns[i])
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		e.w.Write(key)
+		e.w.WriteByte(':')
+		e.w.Write(value)
+	}
+	e.rows++
+	return e.w.WriteByte('}')
+}
+
+func (e *jsonExporter) Close() error {
+	e.w.WriteString("]}\n")
+	return e.w.Flush()
+}
+
+// exportFilters describes the filter shared by the vaccine pages for the header block of a download
+func exportFilters(vaccine store.Vaccine, filter store.Filter) []string {
+	filters := []string{"Vaccine: " + vaccine.Name}
+	if filter.CoAdmin != store.AnyCoAdministration {
+		filters = append(filters, "Other vaccines given: "+filter.CoAdmin.String())
+	}
+	if filter.Region != store.AnyRegion {
+		filters = append(filters, "Region: "+filter.Region.String())
+	}
+	return filters
+}
+
+// exportDoseFilters adds the doses the rates are computed with to the filters of a count download
+func exportDoseFilters(vaccine store.Vaccine, filter store.Filter, doses int64) []string {
+	filters := exportFilters(vaccine, filter)
+	if doses > 0 {
+		filters = append(filters, fmt.Sprintf("Doses administered %s: %d", dosesWhere(filter.Region), doses))
+	}
+	return filters
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/thehungrysmurf/vax/db/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// categoryReportFilter reads the report filter of a category page from its URL, e.g. category/flu-like/female/16/25/.
+// Unknown categories and sexes are a 404, malformed ages a 400.
+func categoryReportFilter(r *http.Request, categories []store.Category) (store.ReportFilter, error) {
+	category, err := categoryParam(r, "name", categories)
+	if err != nil {
+		return store.ReportFilter{}, err
+	}
+
+	sex, err := sexParam(r, "sex")
+	if err != nil {
+		return store.ReportFilter{}, err
+	}
+
+	ages, err := ageGroupParams(r, "agemin", "agemax")
+	if err != nil {
+		return store.ReportFilter{}, err
+	}
+
+	outcome, err := outcomeParam(r)
+	if err != nil {
+		return store.ReportFilter{}, err
+	}
+
+	return store.ReportFilter{
+		Sex:        sex,
+		Ages:       &ages,
+		Categories: []string{category.Slug},
+		Outcome:    outcome,
+	}, nil
+}
+
+// outcomeParam reads the outcome of the reports from the query string, any outcome when it's left out
+func outcomeParam(r *http.Request) (store.Outcome, error) {
+	o := r.URL.Query().Get("outcome")
+	if o == "" {
+		return store.AnyOutcome, nil
+	}
+	outcome := store.OutcomeFromString(o)
+	if outcome == store.AnyOutcome {
+		return outcome, paramError{Status: http.StatusBadRequest, Param: "outcome", Value: o}
+	}
+	return outcome, nil
+}
+
+// categoryParam reads the slug of one of the categories
+func categoryParam(r *http.Request, name string, categories []store.Category) (store.Category, error) {
+	slug := chi.URLParam(r, name)
+	for _, c := range categories {
+		if c.Slug == slug {
+			return c, nil
+		}
+	}
+	return store.Category{}, paramError{Status: http.StatusNotFound, Param: "category", Value: slug}
+}
+
+// sexParam reads the sex of a category page, male or female
+func sexParam(r *http.Request, name string) (store.Sex, error) {
+	s := chi.URLParam(r, name)
+	switch s {
+	case "male":
+		return store.Male, nil
+	case "female":
+		return store.Female, nil
+	default:
+		return store.UnknownSex, paramError{Status: http.StatusNotFound, Param: "sex", Value: s}
+	}
+}
+
+// ageParam reads an age in years
+func ageParam(r *http.Request, name string) (int, error) {
+	s := chi.URLParam(r, name)
+	age, err := strconv.Atoi(s)
+	if err != nil || age < 0 {
+		return 0, paramError{Status: http.StatusBadRequest, Param: "age", Value: s}
+	}
+	return age, nil
+}
+
+// ageGroupParams reads the youngest and oldest ages of a group
+func ageGroupParams(r *http.Request, minName, maxName string) (store.AgeGroup, error) {
+	min, err := ageParam(r, minName)
+	if err != nil {
+		return store.AgeGroup{}, err
+	}
+	max, err := ageParam(r, maxName)
+	if err != nil {
+		return store.AgeGroup{}, err
+	}
+	if min > max {
+		return store.AgeGroup{}, paramError{Status: http.StatusBadRequest, Param: "ages", Value: chi.URLParam(r, minName) + "/" + chi.URLParam(r, maxName)}
+	}
+	return store.AgeGroup{Min: min, Max: max}, nil
+}
@@ -0,0 +1,1466 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/message"
+
+	"github.com/thehungrysmurf/vax/db/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v4"
+)
+
+// NewRouter serves the site and its JSON API from the database. Templates and assets are read from the working
+// directory, the root of the repo.
+func NewRouter(dbClient store.Store) chi.Router {
+	return newRouter(dbClient, false)
+}
+
+// NewStaticRouter is the router the static site is generated through, its pages leave out the links to the searches,
+// reports and forms only the server answers
+func NewStaticRouter(dbClient store.Store) chi.Router {
+	return newRouter(dbClient, true)
+}
+
+func newRouter(dbClient store.Store, static bool) chi.Router {
+	ctx := context.Background()
+	dbClient = newImportRunCache(dbClient)
+
+	r := chi.NewRouter()
+	r.Use(requestID)
+	if static {
+		r.Use(staticSite)
+	}
+
+	workDir, _ := os.Getwd()
+
+	// define handler that serves HTTP requests with the content of the static assets
+	staticAssetsDir := filepath.Join(workDir, "/assets")
+	fs := http.FileServer(http.Dir(staticAssetsDir))
+	// strip the prefix so the path isn't duplicated, which would return an error
+	fs = http.StripPrefix("/assets", fs)
+
+	// serve static assets
+	r.Get("/assets/*", func(w http.ResponseWriter, r *http.Request) {
+		fs.ServeHTTP(w, r)
+	})
+
+	// index lists the vaccines against the illness, and links to the other illnesses on the home page
+	index := func(w http.ResponseWriter, r *http.Request, illnessSlug string) {
+		illness, err := dbClient.GetIllness(ctx, illnessSlug)
+		if errors.Is(err, pgx.ErrNoRows) {
+			notFound(w, r, dbClient)
+			return
+		} else if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get illness: %v", err))
+			return
+		}
+
+		illnesses, err := dbClient.GetIllnesses(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get illnesses: %v", err))
+			return
+		}
+
+		vaccines, err := dbClient.GetVaccines(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get vaccines: %v", err))
+			return
+		}
+
+		totals, err := dbClient.GetVaccinationTotals(ctx, string(store.UnitedStates))
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get vaccination totals: %v", err))
+			return
+		}
+
+		dosesOverTime, err := dbClient.GetDosesOverTime(ctx, illness.Slug, string(store.UnitedStates))
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get doses over time: %v", err))
+			return
+		}
+
+		ret := IndexPage{
+			Title:   "Home",
+			Illness: illness,
+		}
+		if illness.Slug != store.Covid19 {
+			ret.Title = illness.Name
+		}
+		for _, i := range illnesses {
+			if i.Slug != illness.Slug {
+				ret.Illnesses = append(ret.Illnesses, i)
+			}
+		}
+		names := map[int]string{}
+		for _, v := range vaccines {
+			if v.Illness == illness.Slug {
+				ret.Vaccines = append(ret.Vaccines, IndexVaccine{Vaccine: v, Doses: totals[v.ID]})
+				names[v.ID] = v.Name
+			}
+		}
+
+		var d3Doses []D3Doses
+		for _, ds := range dosesOverTime {
+			d3Doses = append(d3Doses, D3Doses{Date: ds.Date.Format("2006-01-02"), Vaccine: names[ds.VaccineID], Total: ds.Total})
+		}
+		if len(d3Doses) > 0 {
+			b, err := json.Marshal(d3Doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to marshal doses over time: %v", err))
+				return
+			}
+			ret.D3Doses = template.JS(b)
+		}
+
+		render(w, r, dbClient, "templates/index.html", ret)
+	}
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		index(w, r, store.Covid19)
+	})
+
+	r.Get("/illness/{illness}/", func(w http.ResponseWriter, r *http.Request) {
+		index(w, r, chi.URLParam(r, "illness"))
+	})
+
+	r.Get("/compare/", func(w http.ResponseWriter, r *http.Request) {
+		illnessSlug := r.URL.Query().Get("illness")
+		if illnessSlug == "" {
+			illnessSlug = store.Covid19
+		}
+		illness, err := dbClient.GetIllness(ctx, illnessSlug)
+		if errors.Is(err, pgx.ErrNoRows) {
+			notFound(w, r, dbClient)
+			return
+		} else if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get illness: %v", err))
+			return
+		}
+
+		illnesses, err := dbClient.GetIllnesses(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get illnesses: %v", err))
+			return
+		}
+
+		categories, err := dbClient.GetCategories(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+			return
+		}
+
+		q := r.URL.Query()
+		ret := ComparePage{
+			Title:      "Compare vaccines",
+			Illness:    illness,
+			Illnesses:  illnesses,
+			Categories: categories,
+			AgeGroups:  store.AgeGroups,
+			AgeGroup:   store.AgeGroupFromString(q.Get("ages")),
+			Filter:     filterFromQuery(r),
+			Per:        perFromQuery(r),
+		}
+
+		// The form's options are left empty for all of them, any other value names nothing to compare
+		if ages := q.Get("ages"); ages != "" && ret.AgeGroup.String() != ages {
+			notFound(w, r, dbClient)
+			return
+		}
+		if s := q.Get("sex"); s != "" {
+			ret.Sex = store.SexFromString(s)
+			if ret.Sex == store.UnknownSex {
+				notFound(w, r, dbClient)
+				return
+			}
+		}
+		if categorySlug := q.Get("category"); categorySlug != "" {
+			for _, c := range categories {
+				if c.Slug == categorySlug {
+					ret.Category = c
+				}
+			}
+			if ret.Category.Slug == "" {
+				notFound(w, r, dbClient)
+				return
+			}
+		}
+
+		if ret.Category.Slug != "" {
+			ret.Title = "Compare vaccines: " + ret.Category.Name
+			ret.Comparison, err = dbClient.GetComparison(ctx, illness.Slug, ret.Category.Slug, ret.Sex, ret.AgeGroup.Min, ret.AgeGroup.Max, ret.Filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get comparison: %v", err))
+				return
+			}
+		}
+		for _, vc := range ret.Comparison {
+			if vc.Doses > 0 {
+				ret.HasDoses = true
+			}
+		}
+
+		render(w, r, dbClient, "templates/compare.html", ret)
+	})
+
+	// Reports with notes matching the q search, e.g. ?q="chest pain" -covid&vaccine=pfizer&sex=female&age=18-64
+	r.Get("/search/", func(w http.ResponseWriter, r *http.Request) {
+		vaccines, err := dbClient.GetVaccines(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get vaccines: %v", err))
+			return
+		}
+
+		categories, err := dbClient.GetCategories(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+			return
+		}
+
+		rf, params, err := reportFilterFromQuery(r, categories)
+		if err != nil {
+			badRequest(w, r, fmt.Errorf("invalid report filter: %v", err))
+			return
+		}
+
+		ret := SearchPage{
+			Title:      "Search reports",
+			Query:      strings.TrimSpace(r.URL.Query().Get("q")),
+			Vaccines:   vaccines,
+			Categories: categories,
+			Filter:     rf,
+			Params:     params,
+			Outcomes:   store.Outcomes,
+		}
+
+		if slug := r.URL.Query().Get("vaccine"); slug != "" {
+			for _, v := range vaccines {
+				if v.Slug == slug {
+					ret.Vaccine = slug
+				}
+			}
+			if ret.Vaccine == "" {
+				badRequest(w, r, fmt.Errorf("unknown vaccine %q", slug))
+				return
+			}
+			params.Set("vaccine", slug)
+		}
+
+		page, err := searchPageFromQuery(r)
+		if err != nil {
+			badRequest(w, r, fmt.Errorf("invalid page: %v", err))
+			return
+		}
+
+		if ret.Query != "" {
+			ret.Title = "Search reports: " + ret.Query
+			params.Set("q", ret.Query)
+			ret.Results, err = dbClient.SearchReports(ctx, ret.Query, ret.Vaccine, rf, page)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to search reports: %v", err))
+				return
+			}
+		}
+
+		render(w, r, dbClient, "templates/search.html", ret)
+	})
+
+	r.Get("/report/{vaersID}/", func(w http.ResponseWriter, r *http.Request) {
+		vaersID, err := strconv.ParseInt(chi.URLParam(r, "vaersID"), 10, 64)
+		if err != nil {
+			notFound(w, r, dbClient)
+			return
+		}
+
+		report, err := dbClient.GetReport(ctx, vaersID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			notFound(w, r, dbClient)
+			return
+		} else if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get report: %v", err))
+			return
+		}
+
+		symptoms, err := dbClient.GetReportSymptoms(ctx, vaersID)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get report symptoms: %v", err))
+			return
+		}
+
+		vaccinations, err := dbClient.GetReportVaccinations(ctx, vaersID)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get report vaccinations: %v", err))
+			return
+		}
+
+		ret := ReportDetailPage{
+			Title:        fmt.Sprintf("VAERS report %d", vaersID),
+			Report:       report,
+			Symptoms:     symptoms,
+			Vaccinations: vaccinations,
+		}
+
+		render(w, r, dbClient, "templates/report.html", ret)
+	})
+
+	r.Get("/about/", func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, dbClient, "templates/about.html", "About")
+	})
+
+	// getVaccine looks up the vaccine in the URL, rendering the 404 page when there's no such vaccine against the illness.
+	// URLs without an illness are for COVID-19 vaccines.
+	getVaccine := func(w http.ResponseWriter, r *http.Request) (store.Vaccine, bool) {
+		illness := chi.URLParam(r, "illness")
+		if illness == "" {
+			illness = store.Covid19
+		}
+
+		vaccine, err := dbClient.GetVaccine(ctx, chi.URLParam(r, "vaccine"))
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && vaccine.Illness != illness) {
+			notFound(w, r, dbClient)
+			return vaccine, false
+		} else if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get vaccine: %v", err))
+			return vaccine, false
+		}
+		return vaccine, true
+	}
+
+	vaccineRoutes := func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+			vaccineSlug := vaccine.Slug
+			filter := filterFromQuery(r)
+
+			doses, err := dbClient.GetDoses(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get doses: %v", err))
+				return
+			}
+
+			catCounts, err := dbClient.GetCategoryCounts(ctx, vaccineSlug, filter, doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get category counts: %v", err))
+				return
+			}
+
+			symCounts, err := dbClient.GetSymptomCounts(ctx, vaccineSlug, filter, doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom counts: %v", err))
+				return
+			}
+
+			lifeThreateningSymCounts, err := dbClient.GetLifeThreateningSymptomCounts(ctx, vaccineSlug, filter, doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get life threatening symptom counts: %v", err))
+				return
+			}
+
+			outcomeCounts, err := dbClient.GetOutcomeCounts(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get outcome counts: %v", err))
+				return
+			}
+
+			categoryOnset, err := dbClient.GetCategoryOnsetDistribution(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get category onset distribution: %v", err))
+				return
+			}
+
+			symptomOnset, err := dbClient.GetSymptomOnsetDistribution(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom onset distribution: %v", err))
+				return
+			}
+
+			countries, states, err := dbClient.GetRegionCounts(ctx, vaccineSlug)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get region counts: %v", err))
+				return
+			}
+
+			doseCounts, err := dbClient.GetDoseSymptomCounts(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get dose symptom counts: %v", err))
+				return
+			}
+
+			lotCounts, err := dbClient.GetLotCounts(ctx, vaccineSlug)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get lot counts: %v", err))
+				return
+			}
+
+			d3SymCounts, err := json.Marshal(symCounts)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to marshal symptom counts: %v", err))
+				return
+			}
+
+			d3LTSymCounts, err := json.Marshal(lifeThreateningSymCounts)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to marshal life threatening symptom counts: %v", err))
+				return
+			}
+
+			ret := VaccinePage{
+				IsOverview:     true,
+				PageTitle:      vaccine.Name,
+				TabTitle:       vaccine.Name,
+				Vaccine:        vaccine.Name,
+				VaccineSlug:    vaccineSlug,
+				VaccinePath:    vaccine.Path(),
+				Filter:         filter,
+				Per:            perFromQuery(r),
+				CoAdmins:       store.CoAdministrations,
+				Countries:      countries,
+				States:         states,
+				CategoryCounts: catCounts,
+				OutcomeCounts:  outcomeCounts,
+				OnsetBuckets:   store.OnsetBuckets,
+				CategoryOnset:  categoryOnset,
+				SymptomOnset:   symptomOnset,
+				Doses:          doses,
+				DoseCounts:     doseCounts,
+				LotCounts:      lotCounts,
+				// The outcomes are offered on the reports filter form
+				ResultsPage:   ResultsPage{Outcomes: store.Outcomes},
+				D3SymCounts:   template.JS(d3SymCounts),
+				D3LTSymCounts: template.JS(d3LTSymCounts),
+				SymCounts:     symCounts,
+				LTSymCounts:   lifeThreateningSymCounts,
+			}
+
+			render(w, r, dbClient, "templates/vaccine.html", ret)
+		})
+
+		r.Get("/chart/{chart}.{format}", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+			vaccineChart(w, r, dbClient, vaccine)
+		})
+
+		// results renders the reports matching the report filter, params are the query string values selecting them, kept
+		// on the outcome links
+		results := func(w http.ResponseWriter, r *http.Request, vaccine store.Vaccine, rf store.ReportFilter, params url.Values) {
+			vaccineSlug := vaccine.Slug
+			filter := filterFromQuery(r)
+
+			page, err := reportPageFromQuery(r)
+			if err != nil {
+				badRequest(w, r, fmt.Errorf("invalid page: %v", err))
+				return
+			}
+
+			categories, err := dbClient.GetCategories(ctx)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+				return
+			}
+
+			doses, err := dbClient.GetDoses(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get doses: %v", err))
+				return
+			}
+
+			counts, err := dbClient.GetCategoryCounts(ctx, vaccineSlug, filter, doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptoms: %v", err))
+				return
+			}
+
+			countries, states, err := dbClient.GetRegionCounts(ctx, vaccineSlug)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get region counts: %v", err))
+				return
+			}
+
+			// A static host ignores the query string, so a static page lists every report rather than a page of them
+			var results store.FilteredResults
+			if isStatic(r) {
+				err = dbClient.StreamFilteredResults(ctx, vaccineSlug, rf, page, filter, func(fr store.FilteredResult) error {
+					results.Results = append(results.Results, fr)
+					return nil
+				})
+				results.Total = int64(len(results.Results))
+			} else {
+				results, err = dbClient.GetFilteredResults(ctx, vaccineSlug, rf, page, filter)
+			}
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get results: %v", err))
+				return
+			}
+
+			var names []string
+			for _, c := range categories {
+				for _, slug := range rf.Categories {
+					if c.Slug == slug {
+						names = append(names, c.Name)
+					}
+				}
+			}
+			categoryName := "All"
+			if len(names) > 0 {
+				categoryName = strings.Join(names, ", ")
+			}
+
+			ret := VaccinePage{
+				PageTitle:      vaccine.Name,
+				TabTitle:       fmt.Sprintf("%s: %s", vaccine.Name, categoryName),
+				Vaccine:        vaccine.Name,
+				VaccineSlug:    vaccineSlug,
+				VaccinePath:    vaccine.Path(),
+				Filter:         filter,
+				Per:            perFromQuery(r),
+				CoAdmins:       store.CoAdministrations,
+				Countries:      countries,
+				States:         states,
+				Doses:          doses,
+				CategoryCounts: counts,
+				ResultsPage: ResultsPage{
+					Vaccine:         vaccine.Name,
+					CurrentCategory: categoryName,
+					Label:           rf.Label(),
+					Params:          params,
+					PageParams:      pageParams(params, page),
+					ExportPath:      strings.TrimSuffix(r.URL.Path, "/"),
+					Outcome:         rf.Outcome,
+					Outcomes:        store.Outcomes,
+					Sort:            page.Sort,
+					Desc:            page.Desc,
+					Sorts:           store.ReportSorts,
+					Results:         results.Results,
+					Total:           results.Total,
+					Prev:            results.Prev,
+					Next:            results.Next,
+				},
+			}
+
+			render(w, r, dbClient, "templates/vaccine.html", ret)
+		}
+
+		r.Get("/category/{name}/{sex}/{agemin}/{agemax}/", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+
+			categories, err := dbClient.GetCategories(ctx)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+				return
+			}
+
+			rf, err := categoryReportFilter(r, categories)
+			if err != nil {
+				paramFailed(w, r, dbClient, err)
+				return
+			}
+
+			results(w, r, vaccine, rf, nil)
+		})
+
+		// Reports selected by the query string, e.g. ?sex=any&age=18-64&category=flu-like,nervous-system
+		r.Get("/reports/", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+
+			categories, err := dbClient.GetCategories(ctx)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+				return
+			}
+
+			rf, params, err := reportFilterFromQuery(r, categories)
+			if err != nil {
+				badRequest(w, r, fmt.Errorf("invalid report filter: %v", err))
+				return
+			}
+
+			results(w, r, vaccine, rf, params)
+		})
+
+		// exportResults downloads every report matching the report filter, in the order of the results page
+		exportResults := func(w http.ResponseWriter, r *http.Request, vaccine store.Vaccine, rf store.ReportFilter) {
+			filter := filterFromQuery(r)
+
+			page, err := reportPageFromQuery(r)
+			if err != nil {
+				badRequest(w, r, fmt.Errorf("invalid page: %v", err))
+				return
+			}
+
+			lastRun, err := dbClient.GetLastImportRun(ctx)
+			if err != nil {
+				log.Printf("failed to get last import run: %v", err)
+			}
+
+			filters := append(exportFilters(vaccine, filter), "Reports: "+rf.Label())
+			if len(rf.Categories) > 0 {
+				filters = append(filters, "Categories: "+strings.Join(rf.Categories, ", "))
+			}
+			if rf.Outcome != store.AnyOutcome {
+				filters = append(filters, "Outcome: "+rf.Outcome.String())
+			}
+			filters = append(filters, "Sorted by: "+page.Sort.String())
+
+			meta := exportMeta{Title: vaccine.Name + " adverse event reports", Filters: filters, Run: lastRun}
+			e, ok := newExporter(w, r, chi.URLParam(r, "format"), vaccine.Slug+"-reports", meta,
+				[]string{"vaers_id", "age", "reported_at", "symptoms", "outcomes", "notes"})
+			if !ok {
+				return
+			}
+
+			err = dbClient.StreamFilteredResults(ctx, vaccine.Slug, rf, page, filter, func(fr store.FilteredResult) error {
+				return e.Row(fr.VaersID, fr.Age, fr.ReportedAt, fr.Symptoms, append([]store.Outcome{}, fr.Outcomes...), fr.Notes)
+			})
+			if err != nil {
+				// The download has started, it can only be cut short
+				log.Printf("failed to export results: %v", err)
+			}
+			if err := e.Close(); err != nil {
+				log.Printf("failed to finish export: %v", err)
+			}
+		}
+
+		r.Get("/category/{name}/{sex}/{agemin}/{agemax}.{format}", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+
+			categories, err := dbClient.GetCategories(ctx)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+				return
+			}
+
+			rf, err := categoryReportFilter(r, categories)
+			if err != nil {
+				paramFailed(w, r, dbClient, err)
+				return
+			}
+
+			exportResults(w, r, vaccine, rf)
+		})
+
+		r.Get("/reports.{format}", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+
+			categories, err := dbClient.GetCategories(ctx)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get categories: %v", err))
+				return
+			}
+
+			rf, _, err := reportFilterFromQuery(r, categories)
+			if err != nil {
+				badRequest(w, r, fmt.Errorf("invalid report filter: %v", err))
+				return
+			}
+
+			exportResults(w, r, vaccine, rf)
+		})
+
+		r.Get("/categories.{format}", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+			filter := filterFromQuery(r)
+
+			doses, err := dbClient.GetDoses(ctx, vaccine.Slug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get doses: %v", err))
+				return
+			}
+
+			counts, err := dbClient.GetCategoryCounts(ctx, vaccine.Slug, filter, doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get category counts: %v", err))
+				return
+			}
+
+			lastRun, err := dbClient.GetLastImportRun(ctx)
+			if err != nil {
+				log.Printf("failed to get last import run: %v", err)
+			}
+
+			meta := exportMeta{Title: vaccine.Name + " reports by symptom category, sex and age", Filters: exportDoseFilters(vaccine, filter, doses), Run: lastRun}
+			e, ok := newExporter(w, r, chi.URLParam(r, "format"), vaccine.Slug+"-categories", meta,
+				[]string{"category", "category_slug", "sex", "ages", "reports", "reports_per_million_doses"})
+			if !ok {
+				return
+			}
+
+			// A row for every category, then one for each of its sexes and age groups
+			for _, cc := range counts {
+				if err := e.Row(cc.Category, cc.CategorySlug, "all", "all", cc.Count, apiRate(cc.Rate, doses)); err != nil {
+					log.Printf("failed to export category counts: %v", err)
+					break
+				}
+				// The sexes and age groups go by their own doses, the rate is left empty where they aren't on record
+				for _, as := range cc.AgeSex {
+					e.Row(cc.Category, cc.CategorySlug, strings.ToLower(as.Sex.String()), as.AgeGroup.String(), as.Count, apiRate(as.Rate, as.Doses))
+				}
+			}
+			if err := e.Close(); err != nil {
+				log.Printf("failed to finish export: %v", err)
+			}
+		})
+
+		r.Get("/symptoms.{format}", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+			filter := filterFromQuery(r)
+
+			doses, err := dbClient.GetDoses(ctx, vaccine.Slug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get doses: %v", err))
+				return
+			}
+
+			counts, err := dbClient.GetSymptomCounts(ctx, vaccine.Slug, filter, doses)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom counts: %v", err))
+				return
+			}
+
+			lastRun, err := dbClient.GetLastImportRun(ctx)
+			if err != nil {
+				log.Printf("failed to get last import run: %v", err)
+			}
+
+			meta := exportMeta{Title: vaccine.Name + " reports by symptom", Filters: exportDoseFilters(vaccine, filter, doses), Run: lastRun}
+			e, ok := newExporter(w, r, chi.URLParam(r, "format"), vaccine.Slug+"-symptoms", meta,
+				[]string{"symptom", "symptom_slug", "category", "reports", "reports_per_million_doses"})
+			if !ok {
+				return
+			}
+
+			for _, sc := range counts {
+				if err := e.Row(sc.Symptom, sc.Slug, sc.Category, sc.Count, apiRate(sc.Rate, doses)); err != nil {
+					log.Printf("failed to export symptom counts: %v", err)
+					break
+				}
+			}
+			if err := e.Close(); err != nil {
+				log.Printf("failed to finish export: %v", err)
+			}
+		})
+
+		r.Get("/symptom/{slug}/", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+			vaccineSlug := vaccine.Slug
+
+			symptom, err := dbClient.GetSymptom(ctx, chi.URLParam(r, "slug"))
+			if errors.Is(err, pgx.ErrNoRows) {
+				notFound(w, r, dbClient)
+				return
+			} else if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom: %v", err))
+				return
+			}
+
+			filter := filterFromQuery(r)
+
+			categories, err := dbClient.GetSymptomCategories(ctx, symptom.ID)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom categories: %v", err))
+				return
+			}
+
+			doses, err := dbClient.GetDoses(ctx, vaccineSlug, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get doses: %v", err))
+				return
+			}
+
+			ageSex, err := dbClient.GetSymptomAgeSexCounts(ctx, vaccineSlug, symptom.ID, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom age and sex counts: %v", err))
+				return
+			}
+
+			coReported, err := dbClient.GetCoReportedSymptoms(ctx, vaccineSlug, symptom.ID, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get co-reported symptoms: %v", err))
+				return
+			}
+
+			onset, err := dbClient.GetSymptomOnset(ctx, vaccineSlug, symptom.ID, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom onset: %v", err))
+				return
+			}
+
+			reports, err := dbClient.GetSymptomReports(ctx, vaccineSlug, symptom.ID, filter)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptom reports: %v", err))
+				return
+			}
+
+			name := symptom.Name
+			if symptom.Alias != "" {
+				name = symptom.Alias
+			}
+
+			ret := SymptomPage{
+				TabTitle:     fmt.Sprintf("%s: %s", vaccine.Name, name),
+				Name:         name,
+				Vaccine:      vaccine,
+				Symptom:      symptom,
+				Categories:   categories,
+				Filter:       filter,
+				Per:          perFromQuery(r),
+				Doses:        doses,
+				CoReported:   coReported,
+				OnsetBuckets: store.OnsetBuckets,
+				Onset:        onset,
+				Reports:      reports,
+			}
+			// The counts come female first, then male, in AgeGroups order
+			if len(ageSex) == 2*len(store.AgeGroups) {
+				for i, ag := range store.AgeGroups {
+					ret.AgeRows = append(ret.AgeRows, AgeRow{AgeGroup: ag, Female: ageSex[i], Male: ageSex[len(store.AgeGroups)+i]})
+				}
+			}
+
+			render(w, r, dbClient, "templates/symptom.html", ret)
+		})
+
+		r.Get("/lot/{lot}/", func(w http.ResponseWriter, r *http.Request) {
+			vaccine, ok := getVaccine(w, r)
+			if !ok {
+				return
+			}
+			vaccineSlug := vaccine.Slug
+			lot, err := urlParam(r, "lot")
+			if err != nil {
+				notFound(w, r, dbClient)
+				return
+			}
+			lot = strings.ToUpper(lot)
+
+			// The lot page shows the counts, not the rates, so it goes without the doses
+			counts, err := dbClient.GetCategoryCounts(ctx, vaccineSlug, store.Filter{}, 0)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get symptoms: %v", err))
+				return
+			}
+
+			results, err := dbClient.GetLotResults(ctx, vaccineSlug, lot)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("failed to get lot results: %v", err))
+				return
+			}
+
+			ret := VaccinePage{
+				PageTitle:      vaccine.Name,
+				TabTitle:       fmt.Sprintf("%s: lot %s", vaccine.Name, lot),
+				Vaccine:        vaccine.Name,
+				VaccineSlug:    vaccineSlug,
+				VaccinePath:    vaccine.Path(),
+				CategoryCounts: counts,
+				ResultsPage: ResultsPage{
+					Vaccine: vaccine.Name,
+					Lot:     lot,
+					Results: results,
+				},
+			}
+
+			render(w, r, dbClient, "templates/vaccine.html", ret)
+		})
+
+	}
+
+	r.Route("/vaccine/{vaccine}", vaccineRoutes)
+	r.Route("/illness/{illness}/vaccine/{vaccine}", vaccineRoutes)
+
+	r.Route(apiPrefix, apiRoutes(dbClient))
+
+	r.Get("/sitemap.xml", sitemap(dbClient))
+	r.Get("/robots.txt", robots)
+
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		notFound(w, r, dbClient)
+	})
+
+	return r
+}
+
+// filterFromQuery reads the filters shared by the vaccine pages from the query string
+func filterFromQuery(r *http.Request) store.Filter {
+	return store.Filter{
+		CoAdmin: store.CoAdministrationFromString(r.URL.Query().Get("coadmin")),
+		Region:  store.RegionFromString(r.URL.Query().Get("region")),
+	}
+}
+
+// reportFilterFromQuery reads the report filter of the reports page from the query string, returning the validated
+// values to keep on links. Sex is any, female, male or unknown, age a range such as 18-64 or 65+, unknownage=include
+// adds reports without an age to the range and category lists category slugs, comma separated or repeated.
+func reportFilterFromQuery(r *http.Request, categories []store.Category) (store.ReportFilter, url.Values, error) {
+	var rf store.ReportFilter
+	q := r.URL.Query()
+	params := url.Values{}
+
+	switch sex := strings.ToLower(q.Get("sex")); sex {
+	case "", "any":
+	case "female", "male", "unknown":
+		rf.Sex = store.SexFromString(sex)
+		params.Set("sex", sex)
+	default:
+		return rf, nil, fmt.Errorf("unknown sex %q", sex)
+	}
+
+	if age := q.Get("age"); age != "" && age != "any" {
+		ages, err := parseAges(age)
+		if err != nil {
+			return rf, nil, err
+		}
+		rf.Ages = &ages
+		params.Set("age", age)
+
+		switch unknown := q.Get("unknownage"); unknown {
+		case "":
+		case "include":
+			rf.UnknownAge = true
+			params.Set("unknownage", unknown)
+		default:
+			return rf, nil, fmt.Errorf("unknownage must be include, not %q", unknown)
+		}
+	}
+
+	for _, value := range q["category"] {
+		for _, slug := range strings.Split(value, ",") {
+			if slug = strings.TrimSpace(slug); slug == "" {
+				continue
+			}
+			known := false
+			for _, c := range categories {
+				if c.Slug == slug {
+					known = true
+				}
+			}
+			if !known {
+				return rf, nil, fmt.Errorf("unknown category %q", slug)
+			}
+			rf.Categories = append(rf.Categories, slug)
+		}
+	}
+	if len(rf.Categories) > 0 {
+		params.Set("category", strings.Join(rf.Categories, ","))
+	}
+
+	outcome, err := outcomeParam(r)
+	if err != nil {
+		return rf, nil, err
+	}
+	rf.Outcome = outcome
+	return rf, params, nil
+}
+
+// maxAge bounds the age ranges of the reports page, 65+ reads as 65 to maxAge
+const maxAge = 120
+
+// parseAges parses an age range such as 18-64 or 65+
+func parseAges(s string) (store.AgeGroup, error) {
+	var ages store.AgeGroup
+	var err error
+	if strings.HasSuffix(s, "+") {
+		ages.Max = maxAge
+		ages.Min, err = strconv.Atoi(strings.TrimSuffix(s, "+"))
+	} else if parts := strings.SplitN(s, "-", 2); len(parts) == 2 {
+		ages.Min, err = strconv.Atoi(parts[0])
+		if err == nil {
+			ages.Max, err = strconv.Atoi(parts[1])
+		}
+	} else {
+		err = errors.New("not a range")
+	}
+	if err != nil || ages.Min < 0 || ages.Min > ages.Max || ages.Max > maxAge {
+		return ages, fmt.Errorf("invalid age range %q, use e.g. 18-64 or 65+", s)
+	}
+	return ages, nil
+}
+
+// urlParam is the route parameter unescaped. The router matches the escaped path when the request has one, e.g. for
+// a lot with an escaped slash, and the decoded path otherwise.
+func urlParam(r *http.Request, key string) (string, error) {
+	v := chi.URLParam(r, key)
+	if r.URL.RawPath == "" {
+		return v, nil
+	}
+	return url.PathUnescape(v)
+}
+
+// reportPageFromQuery reads the page of the results from the query string. Sort is date, age or symptoms, by default
+// the newest reports, the youngest people or the most symptoms first, order=asc or order=desc overrides it. After and
+// before are cursors of the pages around.
+func reportPageFromQuery(r *http.Request) (store.ReportPage, error) {
+	page := store.ReportPage{Sort: store.SortByDate, Size: store.DefaultReportPageSize}
+	q := r.URL.Query()
+
+	if s := q.Get("sort"); s != "" {
+		rs, ok := store.ReportSortFromString(s)
+		if !ok {
+			return page, fmt.Errorf("unknown sort %q", s)
+		}
+		page.Sort = rs
+	}
+
+	switch order := q.Get("order"); order {
+	case "":
+		page.Desc = defaultDesc(page.Sort)
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, fmt.Errorf("order must be asc or desc, not %q", order)
+	}
+
+	if s := q.Get("after"); s != "" {
+		c, err := store.ReportCursorFromString(s)
+		if err != nil {
+			return page, err
+		}
+		page.After = &c
+	}
+	if s := q.Get("before"); s != "" {
+		if page.After != nil {
+			return page, errors.New("after and before can't both be set")
+		}
+		c, err := store.ReportCursorFromString(s)
+		if err != nil {
+			return page, err
+		}
+		page.Before = &c
+	}
+	return page, nil
+}
+
+// searchPageFromQuery reads the page of the search results from the query string, after and before are cursors of the
+// pages around
+func searchPageFromQuery(r *http.Request) (store.SearchResultsPage, error) {
+	page := store.SearchResultsPage{Size: store.DefaultReportPageSize}
+	q := r.URL.Query()
+
+	if s := q.Get("after"); s != "" {
+		c, err := store.SearchCursorFromString(s)
+		if err != nil {
+			return page, err
+		}
+		page.After = &c
+	}
+	if s := q.Get("before"); s != "" {
+		if page.After != nil {
+			return page, errors.New("after and before can't both be set")
+		}
+		c, err := store.SearchCursorFromString(s)
+		if err != nil {
+			return page, err
+		}
+		page.Before = &c
+	}
+	return page, nil
+}
+
+// defaultDesc reports whether the sort lists the largest values first when the order isn't given
+func defaultDesc(rs store.ReportSort) bool {
+	return rs != store.SortByAge
+}
+
+// pageParams adds the sort and order of the page to the params, leaving out the defaults
+func pageParams(params url.Values, page store.ReportPage) url.Values {
+	values := url.Values{}
+	for k, v := range params {
+		values[k] = v
+	}
+	if page.Sort != store.SortByDate {
+		values.Set("sort", string(page.Sort))
+	}
+	if page.Desc != defaultDesc(page.Sort) {
+		order := "asc"
+		if page.Desc {
+			order = "desc"
+		}
+		values.Set("order", order)
+	}
+	return values
+}
+
+// PerMillion shows rates per million doses instead of report counts on the vaccine pages
+const PerMillion = "million"
+
+// perFromQuery reads whether the vaccine pages show counts or rates, empty for counts
+func perFromQuery(r *http.Request) string {
+	if r.URL.Query().Get("per") == PerMillion {
+		return PerMillion
+	}
+	return ""
+}
+
+// dosesWhere says where and up to when the doses the rates go by were administered, e.g. in Canada up to its latest
+// report. Only a country has doses to go by.
+func dosesWhere(r store.Region) string {
+	return "in " + r.String() + " up to its latest report"
+}
+
+func funcMap(lastRun store.ImportRun, canonicalPath, ogImage string, static bool) template.FuncMap {
+	p := message.NewPrinter(message.MatchLanguage("en"))
+
+	return template.FuncMap{
+		"lastUpdated": func() time.Time {
+			return lastRun.UpdatedAt()
+		},
+		// canonicalURL is the page's address on the published site without its query string, empty on error pages
+		"canonicalURL": func() string {
+			if canonicalPath == "" {
+				return ""
+			}
+			return SiteURL + canonicalPath
+		},
+		// ogImage is the absolute URL of the page's preview image, empty when it has none
+		"ogImage": func() string {
+			return ogImage
+		},
+		// static is whether the page is generated into the static site, which has no search, report or form pages
+		"static": func() bool {
+			return static
+		},
+		"dataset": func(name, description string) Dataset {
+			return newDataset(name, description, SiteURL+canonicalPath, lastRun.UpdatedAt())
+		},
+		"ellipsis": func(s string) string {
+			if len(s) > 100 {
+				return s[:100] + "..."
+			}
+			return s
+		},
+		"comma": func(strs []string) string {
+			return strings.Join(strs, ", ")
+		},
+		"formatNum": p.Sprint,
+		"outcome": func(o store.Outcome) string {
+			return o.String()
+		},
+		"coAdmin": func(c store.CoAdministration) string {
+			return c.String()
+		},
+		"region": func(r store.Region) string {
+			return r.String()
+		},
+		"dosesWhere": dosesWhere,
+		// pathEscape escapes a path segment taken from the reports, like a lot, which may hold a slash or a space
+		"pathEscape": url.PathEscape,
+		// yesNo reads a flag left blank on some reports
+		"yesNo": func(b *bool) string {
+			switch {
+			case b == nil:
+				return "Unknown"
+			case *b:
+				return "Yes"
+			default:
+				return "No"
+			}
+		},
+		"onsetIssue": func(o store.OnsetIssue) string {
+			return o.String()
+		},
+		"sex": func(s store.Sex) string {
+			return s.String()
+		},
+		"sortName": func(rs store.ReportSort) string {
+			return rs.String()
+		},
+		// highlight escapes a search result headline and marks the words matching the search
+		"highlight": func(headline string) template.HTML {
+			s := template.HTMLEscapeString(headline)
+			s = strings.ReplaceAll(s, store.HeadlineStart, "<mark>")
+			s = strings.ReplaceAll(s, store.HeadlineStop, "</mark>")
+			return template.HTML(s)
+		},
+		"formatRate": func(rate float64) string {
+			return p.Sprintf("%.1f", rate)
+		},
+		// query builds a query string from key and value pairs, leaving out empty values, empty when all are. A first
+		// url.Values argument is a base the pairs are added to.
+		"query": func(pairs ...interface{}) string {
+			values := url.Values{}
+			if len(pairs) > 0 {
+				if base, ok := pairs[0].(url.Values); ok {
+					for k, v := range base {
+						values[k] = v
+					}
+					pairs = pairs[1:]
+				}
+			}
+			for i := 0; i+1 < len(pairs); i += 2 {
+				if v := queryValue(pairs[i+1]); v != "" {
+					values.Set(fmt.Sprint(pairs[i]), v)
+				}
+			}
+			if len(values) == 0 {
+				return ""
+			}
+			return "?" + values.Encode()
+		},
+	}
+}
+
+// queryValue is the value as it's given in query strings, string types such as store.Region by their value rather than
+// their String name
+func queryValue(v interface{}) string {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+		return rv.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func render(w http.ResponseWriter, r *http.Request, dbClient store.Store, templateName string, ret interface{}) {
+	renderStatus(w, r, dbClient, http.StatusOK, templateName, ret)
+}
+
+// notFound answers 404 with the not found page
+func notFound(w http.ResponseWriter, r *http.Request, dbClient store.Store) {
+	renderStatus(w, r, dbClient, http.StatusNotFound, "templates/404.html", nil)
+}
+
+// renderStatus executes the template into a buffer before writing anything, so an error can still answer 500
+func renderStatus(w http.ResponseWriter, r *http.Request, dbClient store.Store, status int, templateName string, ret interface{}) {
+	lastRun, err := dbClient.GetLastImportRun(r.Context())
+	if err != nil {
+		log.Printf("failed to get last import run: %v", err)
+	}
+
+	// error pages have no canonical URL, they shouldn't be indexed
+	canonicalPath := ""
+	if status == http.StatusOK {
+		canonicalPath = r.URL.EscapedPath()
+	}
+	// pages with a preview image for social sharing have an OGImage method
+	ogImage := ""
+	if p, ok := ret.(interface{ OGImage() string }); ok && p.OGImage() != "" {
+		ogImage = SiteURL + p.OGImage()
+	}
+
+	buf, err := executeTemplate(templateName, funcMap(lastRun, canonicalPath, ogImage, isStatic(r)), ret)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// executeTemplate executes the page template with the header and footer partials
+func executeTemplate(templateName string, fm template.FuncMap, ret interface{}) (*bytes.Buffer, error) {
+	b, err := ioutil.ReadFile(templateName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template file: %v", err)
+	}
+
+	t, err := template.New("").Funcs(fm).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	t, err = t.ParseFiles("templates/header.html", "templates/footer.html", "templates/last_updated.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse partial templates: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ret); err != nil {
+		return nil, fmt.Errorf("failed to execute template %s: %v", templateName, err)
+	}
+	return &buf, nil
+}
+
+type VaccinePage struct {
+	IsOverview  bool
+	PageTitle   string
+	TabTitle    string
+	Vaccine     string
+	VaccineSlug string
+	VaccinePath string
+	Filter      store.Filter
+	CoAdmins    []store.CoAdministration
+	// Countries and States with reports for the vaccine, to filter by region
+	Countries []store.RegionCount
+	States    []store.RegionCount
+	// Per is PerMillion to show rates instead of counts, which only applies when Doses is known
+	Per string
+	// Doses administered in the filtered country up to its latest report, zero for other regions
+	Doses          int64
+	CategoryCounts []store.CategoryCount
+	OutcomeCounts  []store.OutcomeCount
+	OnsetBuckets   []store.OnsetBucket
+	CategoryOnset  []store.OnsetDistribution
+	SymptomOnset   []store.OnsetDistribution
+	DoseCounts     []store.DoseSymptomCounts
+	LotCounts      []store.LotCount
+	// Categories are offered on the reports filter form
+	Categories    []store.Category
+	ResultsPage   ResultsPage
+	D3SymCounts   template.JS
+	D3LTSymCounts template.JS
+	// SymCounts and LTSymCounts are the charts' data, listed in tables for readers without JavaScript
+	SymCounts   []store.SymptomCount
+	LTSymCounts []store.SymptomCount
+}
+
+// OGImage is the symptoms chart shared as the overview's preview image
+func (p VaccinePage) OGImage() string {
+	if !p.IsOverview {
+		return ""
+	}
+	return p.VaccinePath + "/chart/" + SymptomsChart + ".png"
+}
+
+type ResultsPage struct {
+	Vaccine         string
+	CurrentCategory string
+	// Lot is set when listing the reports of a vaccine lot instead of a category
+	Lot string
+	// Label describes the sexes and ages listed
+	Label string
+	// Params are the query string values selecting the reports on the reports page, PageParams add their order
+	Params     url.Values
+	PageParams url.Values
+	// ExportPath is the path of the downloads of the reports without the format extension
+	ExportPath string
+	Outcome    store.Outcome
+	Outcomes   []store.Outcome
+	Sort       store.ReportSort
+	Desc       bool
+	Sorts      []store.ReportSort
+	// Results are a page of Total reports, Prev and Next are the cursors of the pages around it
+	Results []store.FilteredResult
+	Total   int64
+	Prev    *store.ReportCursor
+	Next    *store.ReportCursor
+}
+
+type SymptomPage struct {
+	TabTitle string
+	// Name is the plain English alias of the symptom, or its MedDRA term when there's none
+	Name       string
+	Vaccine    store.Vaccine
+	Symptom    store.Symptom
+	Categories []store.Category
+	Filter     store.Filter
+	Per        string
+	Doses      int64
+	AgeRows    []AgeRow
+	CoReported []store.SymptomCount
+	// OnsetBuckets label the Onset counts
+	OnsetBuckets []store.OnsetBucket
+	Onset        store.OnsetDistribution
+	Reports      []store.FilteredResult
+}
+
+// AgeRow is an age group's female and male counts, a row of the symptom page's table
+type AgeRow struct {
+	AgeGroup store.AgeGroup
+	Female   store.AgeSexCount
+	Male     store.AgeSexCount
+}
+
+type ComparePage struct {
+	Title      string
+	Illness    store.Illness
+	Illnesses  []store.Illness
+	Categories []store.Category
+	// Category is empty until one is picked
+	Category  store.Category
+	AgeGroups []store.AgeGroup
+	// Sex and AgeGroup are zero when the comparison covers everyone
+	Sex        store.Sex
+	AgeGroup   store.AgeGroup
+	Filter     store.Filter
+	Per        string
+	Comparison []store.VaccineComparison
+	// HasDoses is set when at least one vaccine has doses to compute rates with
+	HasDoses bool
+}
+
+type SearchPage struct {
+	Title string
+	// Query is empty until a search is made
+	Query      string
+	Vaccine    string
+	Vaccines   []store.Vaccine
+	Categories []store.Category
+	Filter     store.ReportFilter
+	// Params are the query string values of the search, for the links to the other pages
+	Params   url.Values
+	Outcomes []store.Outcome
+	Results  store.SearchResults
+}
+
+type ReportDetailPage struct {
+	Title        string
+	Report       store.Report
+	Symptoms     []store.ReportSymptom
+	Vaccinations []store.ReportVaccination
+}
+
+type IndexPage struct {
+	Title   string
+	Illness store.Illness
+	// Illnesses are the other illnesses with vaccines on the site
+	Illnesses []store.Illness
+	Vaccines  []IndexVaccine
+	// D3Doses are the cumulative doses administered in the US over time, empty when there are none
+	D3Doses template.JS
+}
+
+// D3Doses is a point on the doses over time chart
+type D3Doses struct {
+	Date    string
+	Vaccine string
+	Total   int64
+}
+
+type IndexVaccine struct {
+	Vaccine store.Vaccine
+	// Doses is zero when the vaccination totals don't break the vaccine out
+	Doses int64
+}
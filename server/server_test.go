@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/thehungrysmurf/vax/db/store"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// The templates are read relative to the working directory, the root of the repository when serving
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		log.Fatalf("failed to change to the repository root: %v", err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeStore serves one illness, one vaccine and one category, the methods the tests don't reach panic on the nil Store.
+// Err fails the doses and the reports of the results page, VaccineErr the lookup of the vaccine.
+type fakeStore struct {
+	store.Store
+	Err        error
+	VaccineErr error
+}
+
+func (s fakeStore) GetLastImportRun(ctx context.Context) (store.ImportRun, error) {
+	return store.ImportRun{}, nil
+}
+
+func (s fakeStore) GetVaccine(ctx context.Context, slug string) (store.Vaccine, error) {
+	if s.VaccineErr != nil {
+		return store.Vaccine{}, s.VaccineErr
+	}
+	if slug != "pfizer" {
+		return store.Vaccine{}, pgx.ErrNoRows
+	}
+	return store.Vaccine{ID: 1, Illness: store.Covid19, Slug: "pfizer", Name: "Pfizer"}, nil
+}
+
+func (s fakeStore) GetIllness(ctx context.Context, slug string) (store.Illness, error) {
+	if slug != store.Covid19 {
+		return store.Illness{}, pgx.ErrNoRows
+	}
+	return store.Illness{Slug: store.Covid19, Name: "COVID-19"}, nil
+}
+
+func (s fakeStore) GetIllnesses(ctx context.Context) ([]store.Illness, error) {
+	return []store.Illness{{Slug: store.Covid19, Name: "COVID-19"}}, nil
+}
+
+func (s fakeStore) GetCategories(ctx context.Context) ([]store.Category, error) {
+	return []store.Category{{Name: "Pain", Slug: "pain"}}, nil
+}
+
+func (s fakeStore) GetCategoryCounts(ctx context.Context, vaccineSlug string, filter store.Filter, doses int64) ([]store.CategoryCount, error) {
+	return nil, nil
+}
+
+func (s fakeStore) GetDoses(ctx context.Context, vaccineSlug string, filter store.Filter) (int64, error) {
+	return 0, s.Err
+}
+
+func (s fakeStore) GetRegionCounts(ctx context.Context, vaccineSlug string) ([]store.RegionCount, []store.RegionCount, error) {
+	return nil, nil, nil
+}
+
+func (s fakeStore) GetFilteredResults(ctx context.Context, vaccineSlug string, rf store.ReportFilter, page store.ReportPage, filter store.Filter) (store.FilteredResults, error) {
+	return store.FilteredResults{}, s.Err
+}
+
+func serve(t *testing.T, dbClient store.Store, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveWith(t, NewRouter(dbClient), path)
+}
+
+func serveWith(t *testing.T, router http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestCategoryPageStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"found", "/vaccine/pfizer/category/pain/female/16/25/", http.StatusOK},
+		{"unknown vaccine", "/vaccine/nope/category/pain/female/16/25/", http.StatusNotFound},
+		{"unknown category", "/vaccine/pfizer/category/nope/female/16/25/", http.StatusNotFound},
+		{"unknown sex", "/vaccine/pfizer/category/pain/unknown/16/25/", http.StatusNotFound},
+		{"malformed age", "/vaccine/pfizer/category/pain/female/x/25/", http.StatusBadRequest},
+		{"negative age", "/vaccine/pfizer/category/pain/female/-1/25/", http.StatusBadRequest},
+		{"inverted ages", "/vaccine/pfizer/category/pain/female/25/16/", http.StatusBadRequest},
+		{"bad outcome", "/vaccine/pfizer/category/pain/female/16/25/?outcome=nope", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, fakeStore{}, tt.path)
+			if rec.Code != tt.status {
+				t.Errorf("GET %s: got status %d, want %d", tt.path, rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+// The download failing before it starts answers the error page, like the page it's downloaded from
+func TestExportStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"categories", "/vaccine/pfizer/categories.csv", http.StatusOK},
+		{"unknown format", "/vaccine/pfizer/categories.xml", http.StatusNotFound},
+		{"unknown category", "/vaccine/pfizer/category/nope/female/16/25.csv", http.StatusNotFound},
+		{"malformed age", "/vaccine/pfizer/category/pain/female/x/25.csv", http.StatusBadRequest},
+		{"bad outcome", "/vaccine/pfizer/reports.csv?outcome=nope", http.StatusBadRequest},
+		{"bad sort", "/vaccine/pfizer/reports.json?sort=nope", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, fakeStore{}, tt.path)
+			if rec.Code != tt.status {
+				t.Errorf("GET %s: got status %d, want %d", tt.path, rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+// The compare form leaves its options empty for all of them, a value it doesn't offer is a page that doesn't exist
+func TestComparePageStatus(t *testing.T) {
+	for _, q := range []string{"illness=nope", "category=nope", "sex=other", "ages=1-2"} {
+		if rec := serve(t, fakeStore{}, "/compare/?"+q); rec.Code != http.StatusNotFound {
+			t.Errorf("GET /compare/?%s: got status %d, want %d", q, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestServerError(t *testing.T) {
+	for _, path := range []string{
+		"/vaccine/pfizer/category/pain/female/16/25/",
+		"/vaccine/pfizer/categories.csv",
+		"/vaccine/pfizer/symptoms.json",
+	} {
+		rec := serve(t, fakeStore{Err: errors.New("connection refused")}, path)
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("GET %s: got status %d, want %d", path, rec.Code, http.StatusInternalServerError)
+		}
+
+		id := rec.Header().Get("X-Request-ID")
+		if id == "" {
+			t.Fatalf("GET %s: missing X-Request-ID header", path)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, "Something went wrong") || !strings.Contains(body, id) {
+			t.Errorf("GET %s: error page doesn't show the request ID %s:\n%s", path, id, body)
+		}
+		if strings.Contains(body, "connection refused") {
+			t.Errorf("GET %s: error page shows the error's details", path)
+		}
+	}
+}
+
+// A failed vaccine lookup answers 500 on every page of the vaccine, without going on to the queries after it
+func TestVaccineLookupError(t *testing.T) {
+	dbClient := fakeStore{VaccineErr: errors.New("connection refused")}
+	for _, path := range []string{
+		"/vaccine/pfizer/",
+		"/illness/covid19/vaccine/pfizer/",
+		"/vaccine/pfizer/category/pain/female/16/25/",
+		"/vaccine/pfizer/reports/",
+		"/vaccine/pfizer/symptom/headache/",
+		"/vaccine/pfizer/lot/EL1/",
+		"/vaccine/pfizer/chart/symptoms.png",
+		"/vaccine/pfizer/categories.csv",
+		"/api/v1/vaccines/pfizer/categories",
+		"/api/v1/vaccines/pfizer/reports",
+	} {
+		rec := serve(t, dbClient, path)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s: got status %d, want %d", path, rec.Code, http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s fakeStore) GetVaccines(ctx context.Context) ([]store.Vaccine, error) {
+	return []store.Vaccine{{ID: 1, Illness: store.Covid19, Slug: "pfizer", Name: "Pfizer"}}, nil
+}
+
+// SearchReports answers a page between two cursors, echoing the one it was given as the previous page's
+func (s fakeStore) SearchReports(ctx context.Context, query, vaccineSlug string, rf store.ReportFilter, page store.SearchResultsPage) (store.SearchResults, error) {
+	return store.SearchResults{
+		Results: []store.SearchResult{{VaersID: 7, Sex: store.Female, ReportedAt: "2021-01-01"}},
+		Total:   100,
+		Prev:    page.After,
+		Next:    &store.SearchCursor{Rank: 0.0607927, VaersID: 7},
+	}, nil
+}
+
+func TestSearchPages(t *testing.T) {
+	rec := serve(t, fakeStore{}, "/search/?q=fever&after=0.5_9")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, link := range []string{"before=0.5_9", "after=0.0607927_7"} {
+		if !strings.Contains(body, link) {
+			t.Errorf("missing the page link %s", link)
+		}
+	}
+
+	for _, q := range []string{"after=x_1", "after=0.5", "after=NaN_1", "after=0.5_1&before=0.5_1"} {
+		if rec := serve(t, fakeStore{}, "/search/?q=fever&"+q); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /search/?%s: got status %d, want %d", q, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// lotStore records the lot looked up and the vaccine it was looked up among
+type lotStore struct {
+	fakeStore
+	vaccineSlug, lot *string
+}
+
+func (s lotStore) GetLotResults(ctx context.Context, vaccineSlug, lot string) ([]store.FilteredResult, error) {
+	*s.vaccineSlug, *s.lot = vaccineSlug, lot
+	return nil, nil
+}
+
+// Lots are free text, a lot's path escapes a slash or a space in it
+func TestLotPage(t *testing.T) {
+	for path, want := range map[string]string{
+		"/vaccine/pfizer/lot/el1/":        "EL1",
+		"/vaccine/pfizer/lot/EL%201%2F2/": "EL 1/2",
+		"/vaccine/pfizer/lot/el%201/":     "EL 1",
+		"/vaccine/pfizer/lot/100%25%2Fa/": "100%/A",
+	} {
+		var vaccineSlug, lot string
+		rec := serve(t, lotStore{vaccineSlug: &vaccineSlug, lot: &lot}, path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d, want %d", path, rec.Code, http.StatusOK)
+		}
+		if vaccineSlug != "pfizer" || lot != want {
+			t.Errorf("GET %s: looked up lot %q of %q, want lot %q of pfizer", path, lot, vaccineSlug, want)
+		}
+	}
+}
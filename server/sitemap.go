@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+// SiteURL is where the site is published, the base of its canonical URLs
+const SiteURL = "https://www.knowyourvaccine.org"
+
+// gynecological is the category left out of the male pages
+const gynecological = "gynecological"
+
+// SitePaths lists the pages of the site from the illnesses, vaccines, categories, symptoms and lots in the database,
+// the ones in the sitemap and generated into the static site. The symptom and lot pages are the ones linked from the
+// vaccine pages. Search, report and reports pages are only served, they take a query or are too many to list, and so is
+// the compare page in the static site, which has no form to pick a comparison with.
+func SitePaths(ctx context.Context, dbClient store.Store, static bool) ([]string, error) {
+	paths := []string{"/", "/about/"}
+	if !static {
+		paths = append(paths, "/compare/")
+	}
+
+	illnesses, err := dbClient.GetIllnesses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get illnesses: %v", err)
+	}
+	for _, i := range illnesses {
+		if i.Slug != store.Covid19 {
+			paths = append(paths, i.Path())
+		}
+	}
+
+	vaccines, err := dbClient.GetVaccines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaccines: %v", err)
+	}
+	categories, err := dbClient.GetCategories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %v", err)
+	}
+	for _, v := range vaccines {
+		paths = append(paths, v.Path()+"/")
+		for _, sex := range []store.Sex{store.Male, store.Female} {
+			for _, c := range categories {
+				if c.Slug == gynecological && sex == store.Male {
+					continue
+				}
+				for _, ag := range store.AgeGroups {
+					cell := store.AgeSexCount{Sex: sex, AgeGroup: ag}
+					paths = append(paths, fmt.Sprintf("%s/category/%s/%s/", v.Path(), c.Slug, cell.Path()))
+				}
+			}
+		}
+
+		symptoms, err := linkedSymptoms(ctx, dbClient, v)
+		if err != nil {
+			return nil, err
+		}
+		for _, slug := range symptoms {
+			paths = append(paths, fmt.Sprintf("%s/symptom/%s/", v.Path(), slug))
+		}
+
+		lots, err := dbClient.GetLotCounts(ctx, v.Slug)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get lot counts: %v", err)
+		}
+		for _, lc := range lots {
+			paths = append(paths, fmt.Sprintf("%s/lot/%s/", v.Path(), url.PathEscape(lc.Lot)))
+		}
+	}
+	return paths, nil
+}
+
+// linkedSymptoms are the slugs of the symptoms the vaccine page links to, from its symptom, onset and dose tables
+func linkedSymptoms(ctx context.Context, dbClient store.Store, v store.Vaccine) ([]string, error) {
+	var slugs []string
+	seen := map[string]bool{}
+	add := func(slug string) {
+		if !seen[slug] {
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+
+	// The vaccine page is unfiltered in the sitemap, and the links don't depend on the rates
+	symCounts, err := dbClient.GetSymptomCounts(ctx, v.Slug, store.Filter{}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get symptom counts: %v", err)
+	}
+	lifeThreatening, err := dbClient.GetLifeThreateningSymptomCounts(ctx, v.Slug, store.Filter{}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get life threatening symptom counts: %v", err)
+	}
+	for _, sc := range append(symCounts, lifeThreatening...) {
+		add(sc.Slug)
+	}
+
+	onset, err := dbClient.GetSymptomOnsetDistribution(ctx, v.Slug, store.Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get symptom onset distribution: %v", err)
+	}
+	for _, od := range onset {
+		add(od.Slug)
+	}
+
+	doses, err := dbClient.GetDoseSymptomCounts(ctx, v.Slug, store.Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dose symptom counts: %v", err)
+	}
+	for _, dc := range doses {
+		for _, sc := range dc.Symptoms {
+			add(sc.Slug)
+		}
+	}
+	return slugs, nil
+}
+
+// staticSite marks the requests rendering the static site, see NewStaticRouter
+func staticSite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), staticSiteKey, true)))
+	})
+}
+
+// isStatic is whether the request renders a page of the static site
+func isStatic(r *http.Request) bool {
+	static, _ := r.Context().Value(staticSiteKey).(bool)
+	return static
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+	// LastMod is the date of the data on every page, left out before the first import
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemap lists the site's pages, all last modified when the data was imported
+func sitemap(dbClient store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		paths, err := SitePaths(ctx, dbClient, isStatic(r))
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to list pages: %v", err))
+			return
+		}
+
+		lastRun, err := dbClient.GetLastImportRun(ctx)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("failed to get last import run: %v", err))
+			return
+		}
+		var lastMod string
+		if updated := lastRun.UpdatedAt(); !updated.IsZero() {
+			lastMod = updated.Format("2006-01-02")
+		}
+
+		set := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+		for _, p := range paths {
+			set.URLs = append(set.URLs, sitemapURL{Loc: SiteURL + p, LastMod: lastMod})
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString(xml.Header)
+		enc := xml.NewEncoder(&buf)
+		enc.Indent("", "  ")
+		if err := enc.Encode(set); err != nil {
+			serverError(w, r, fmt.Errorf("failed to encode sitemap: %v", err))
+			return
+		}
+		buf.WriteString("\n")
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
+
+// robots lets crawlers index the pages in the sitemap, but not the searches and API answers behind them
+func robots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "User-agent: *\nDisallow: /search/\nDisallow: %s/\n\nSitemap: %s/sitemap.xml\n", apiPrefix, SiteURL)
+}
+
+// Dataset is the schema.org description of the reports shown on a page, embedded in it as JSON-LD
+type Dataset struct {
+	Context      string          `json:"@context"`
+	Type         string          `json:"@type"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	URL          string          `json:"url"`
+	DateModified string          `json:"dateModified,omitempty"`
+	IsBasedOn    string          `json:"isBasedOn"`
+	Creator      []DatasetPerson `json:"creator"`
+}
+
+type DatasetPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+func newDataset(name, description, url string, updatedAt time.Time) Dataset {
+	d := Dataset{
+		Context:     "https://schema.org",
+		Type:        "Dataset",
+		Name:        name,
+		Description: description,
+		URL:         url,
+		IsBasedOn:   "https://vaers.hhs.gov/data.html",
+		Creator: []DatasetPerson{
+			{Type: "Person", Name: "Silvia Gheorghita"},
+			{Type: "Person", Name: "Dane Harrigan"},
+		},
+	}
+	if !updatedAt.IsZero() {
+		d.DateModified = updatedAt.Format("2006-01-02")
+	}
+	return d
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/thehungrysmurf/vax/db/store"
+)
+
+// siteStore links the vaccine page to a few symptoms, some of them from more than one table, and to lots, one of them
+// with a space and a slash
+type siteStore struct {
+	fakeStore
+}
+
+func (s siteStore) GetIllnesses(ctx context.Context) ([]store.Illness, error) {
+	return []store.Illness{{Slug: store.Covid19}, {Slug: "flu"}}, nil
+}
+
+func (s siteStore) GetSymptomCounts(ctx context.Context, vaccineSlug string, filter store.Filter, doses int64) ([]store.SymptomCount, error) {
+	return []store.SymptomCount{{Slug: "headache"}}, nil
+}
+
+func (s siteStore) GetLifeThreateningSymptomCounts(ctx context.Context, vaccineSlug string, filter store.Filter, doses int64) ([]store.SymptomCount, error) {
+	return []store.SymptomCount{{Slug: "headache"}, {Slug: "anaphylaxis"}}, nil
+}
+
+func (s siteStore) GetSymptomOnsetDistribution(ctx context.Context, vaccineSlug string, filter store.Filter) ([]store.OnsetDistribution, error) {
+	return []store.OnsetDistribution{{Slug: "fever"}}, nil
+}
+
+func (s siteStore) GetDoseSymptomCounts(ctx context.Context, vaccineSlug string, filter store.Filter) ([]store.DoseSymptomCounts, error) {
+	return []store.DoseSymptomCounts{{Dose: "1", Symptoms: []store.SymptomCount{{Slug: "fatigue"}, {Slug: "fever"}}}}, nil
+}
+
+func (s siteStore) GetLotCounts(ctx context.Context, vaccineSlug string) ([]store.LotCount, error) {
+	return []store.LotCount{{Lot: "EL1", Count: 3}, {Lot: "EL 1/2", Count: 2}}, nil
+}
+
+func (s siteStore) GetFilteredResults(ctx context.Context, vaccineSlug string, rf store.ReportFilter, page store.ReportPage, filter store.Filter) (store.FilteredResults, error) {
+	return store.FilteredResults{Results: []store.FilteredResult{{VaersID: 7, ReportedAt: "2021-01-01"}}, Total: 1}, nil
+}
+
+// StreamFilteredResults lists more reports than a page of GetFilteredResults
+func (s siteStore) StreamFilteredResults(ctx context.Context, vaccineSlug string, rf store.ReportFilter, page store.ReportPage, filter store.Filter, fn func(store.FilteredResult) error) error {
+	for _, id := range []int64{7, 8} {
+		if err := fn(store.FilteredResult{VaersID: id, ReportedAt: "2021-01-01", Notes: fmt.Sprintf("report %d", id)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSitePaths(t *testing.T) {
+	for _, static := range []bool{false, true} {
+		paths, err := SitePaths(context.Background(), siteStore{}, static)
+		if err != nil {
+			t.Fatalf("failed to list pages: %v", err)
+		}
+
+		listed := map[string]int{}
+		for _, p := range paths {
+			listed[p]++
+		}
+		for _, p := range []string{
+			"/vaccine/pfizer/",
+			"/vaccine/pfizer/category/pain/female/16/25/",
+			"/vaccine/pfizer/symptom/headache/",
+			"/vaccine/pfizer/symptom/anaphylaxis/",
+			"/vaccine/pfizer/symptom/fever/",
+			"/vaccine/pfizer/symptom/fatigue/",
+			"/vaccine/pfizer/lot/EL1/",
+			"/vaccine/pfizer/lot/EL%201%2F2/",
+		} {
+			if listed[p] != 1 {
+				t.Errorf("static %t: %s listed %d times, want once", static, p, listed[p])
+			}
+		}
+		// The static site has no compare form
+		if compare := listed["/compare/"] > 0; compare == static {
+			t.Errorf("static %t: /compare/ listed %d times", static, listed["/compare/"])
+		}
+	}
+}
+
+func TestDownloadPaths(t *testing.T) {
+	paths, err := DownloadPaths(context.Background(), siteStore{})
+	if err != nil {
+		t.Fatalf("failed to list downloads: %v", err)
+	}
+	for _, p := range paths {
+		if rec := serve(t, siteStore{}, p); rec.Code != http.StatusOK {
+			t.Errorf("GET %s: got status %d, want %d", p, rec.Code, http.StatusOK)
+		}
+	}
+	if len(paths) != 4 {
+		t.Errorf("got %d downloads, want 4: %v", len(paths), paths)
+	}
+}
+
+// The static site's pages don't link to the pages only the server answers
+func TestStaticLinks(t *testing.T) {
+	serverOnly := []string{`href="/search/"`, `href="/compare/"`, `href="/report/7/"`, "Download these reports", "Outcome:", "Sort by:", "Reports per million doses"}
+	path := "/vaccine/pfizer/category/pain/female/16/25/"
+
+	live := serve(t, siteStore{}, path).Body.String()
+	for _, s := range serverOnly {
+		if !strings.Contains(live, s) {
+			t.Errorf("served page is missing %s", s)
+		}
+	}
+
+	rec := serveWith(t, NewStaticRouter(siteStore{}), path)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	for _, s := range serverOnly {
+		if strings.Contains(rec.Body.String(), s) {
+			t.Errorf("static page has %s", s)
+		}
+	}
+	// A static host ignores the query string, so the page lists every report rather than the first page
+	if !strings.Contains(rec.Body.String(), "report 8") {
+		t.Error("static page is missing the reports after the first page")
+	}
+}